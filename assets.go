@@ -23,10 +23,13 @@
 package servefiles
 
 import (
+	"fmt"
 	"io/fs"
 	"net/http"
 	"os"
-	"sync"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/rickb777/path"
@@ -51,24 +54,102 @@ type Assets struct {
 	// http.NotFound is used.
 	NotFound http.Handler
 
-	// Configurable http.Handler which is called when the request method is neither HEAD nor GET. If it is not
-	// set a basic handler like http.NotFound is used.
+	// Configurable http.Handler which is called when the request method is not HEAD, GET or OPTIONS. If it is
+	// not set a basic handler like http.NotFound is used. Because HEAD requests never reach this handler, it
+	// can always write a response body. It should set the Allow header, as required by RFC9110.
+	// OPTIONS requests always receive a 204-no content response with the Allow header. TRACE and CONNECT
+	// requests never reach this handler; they always receive the basic 405 response.
 	MethodNotAllowed http.Handler
 
 	// DisableDirListing prevents directory listings being generated with the URL path ends with '/'.
 	// If an index.html file is present, it is served for its directory path regardless of this setting.
 	// Otherwise, a directory listing page will be generated if this flag is false, or when it is true
-	// a 404-not found is given.
+	// a 404-not found is given. If the index.html file exists but cannot be read, the error (e.g. a
+	// 403-forbidden) is given instead of a listing.
 	DisableDirListing bool
 
 	// the local filesystem (remember that all paths are relative to its root)
-	fs               fs.FS
-	server           http.Handler
-	expiryElasticity time.Duration
-	timestamp        int64
-	timestampExpiry  string
-	maxAgeS          int // max age in seconds (pre-calculated)
-	lock             *sync.Mutex
+	fs                     fs.FS
+	acceptRanges           bool
+	errorText              map[code]string
+	errorPages             map[code]errorPage
+	sunset                 map[string]time.Time
+	healthPath             string
+	buildToken             string
+	preloaded              map[string]*memFile
+	redirectTrailingSlash  bool
+	cacheBypassHeader      string
+	digestAlgo             string
+	hashes                 *hashCache
+	maxFileSize            int64
+	noCompressionHTTP10    bool
+	contentSecurityPolicy  string
+	allowedHosts           List[string]
+	maxAgeClamp            time.Duration
+	identitySuffix         string
+	weakETagsOnly          bool
+	decompressFallback     bool
+	defaultMaxAge          time.Duration
+	hasDefaultMaxAge       bool
+	aliases                map[string]string
+	expiresThreshold       time.Duration
+	canonicalScheme        string
+	canonicalHost          string
+	trustForwarded         bool
+	etags                  map[string]string
+	autoHead               bool
+	slowServeThreshold     time.Duration
+	extraVary              []string
+	enabledEncodings       List[string]
+	originalLastModified   bool
+	minCompressionRatio    float64
+	legalBlocks            map[string]string
+	compressedContentETags bool
+	indexRedirect          bool
+	contentTypes           map[string]string
+	compressionDecider     func(*http.Request) bool
+	varyCookie             bool
+	noStdlibRedirects      bool
+	compressDirListing     bool
+	expiresHTTP1Only       bool
+	hybridETagThreshold    int64
+	extensionRewrites      map[string]string
+	encodingInETag         bool
+	notFoundRetries        int
+	notFoundRetryDelay     time.Duration
+	noTransform            bool
+	defaultFiles           map[string]*defaultFile
+	preferredEncoding      func(*http.Request) string
+	cacheByStatus          map[code]time.Duration
+	corsOrigins            List[string]
+	corsCredentials        bool
+	listingRules           []listingRule
+	headerRules            []headerRule
+	authorize              func(*http.Request) bool
+	unauthorized           http.Handler
+	dprConvention          string
+	compressions           chan struct{}
+	encodingBucket         bool
+	compositeETags         map[string][]string
+	emptyHeadNoContent     bool
+	rateLimit              *tokenBucket
+	baseHref               string
+	lowercasePaths         bool
+	breaker                *circuitBreaker
+	cspNonce               bool
+	permissionsPolicy      string
+	crossOriginIsolation   bool
+	debugHeader            string
+	debugSuffix            string
+	debugExts              []string
+	reportingName          string
+	reportingURL           string
+	resolvedPathHeader     bool
+	zstdDictionary         *zstdDictionary
+	noIndexResolution      bool
+	server                 http.Handler
+	httpFS                 http.FileSystem // the filesystem used by server
+	expiry                 *atomic.Pointer[cachedExpiry]
 }
 
 // Type conformance proof
@@ -92,17 +173,23 @@ func NewAssetHandlerFS(fs afero.Fs) *Assets {
 	return &Assets{
 		fs:     afero.NewIOFS(fs),
 		server: http.FileServer(afero.NewHttpFs(fs)),
-		lock:   &sync.Mutex{},
+		httpFS: afero.NewHttpFs(fs),
+		hashes: newHashCache(),
+		expiry: new(atomic.Pointer[cachedExpiry]),
 	}
 }
 
 // NewAssetHandlerIoFS creates an Assets value for a given filesystem.
-// Implementations include os.DirFS.
+// Implementations include os.DirFS, embed.FS and *zip.Reader, so assets can be served directly
+// from a zip archive. The standard library has no fs.FS for tar archives; these need unpacking
+// or a third-party fs.FS implementation.
 func NewAssetHandlerIoFS(fs fs.FS) *Assets {
 	return &Assets{
 		fs:     fs,
 		server: http.FileServer(http.FS(fs)),
-		lock:   &sync.Mutex{},
+		httpFS: http.FS(fs),
+		hashes: newHashCache(),
+		expiry: new(atomic.Pointer[cachedExpiry]),
 	}
 }
 
@@ -110,6 +197,9 @@ func NewAssetHandlerIoFS(fs fs.FS) *Assets {
 // looking for the matching asset. For example, if StripOff(2) has been applied, the requested
 // path "/a/b/c/d/doc.js" would be shortened to "c/d/doc.js".
 //
+// A requested path with fewer segments than this, e.g. "/a" in the example, gets a 404-not found
+// response. A path with exactly this number of segments, e.g. "/a/b", refers to the root directory.
+//
 // The returned handler is a new copy of the original one.
 func (a Assets) StripOff(unwantedPrefixSegments int) *Assets {
 	if unwantedPrefixSegments < 0 {
@@ -127,7 +217,46 @@ func (a Assets) WithMaxAge(maxAge time.Duration) *Assets {
 		panic("Negative maxAge")
 	}
 	a.MaxAge = maxAge
-	a.maxAgeS = int(maxAge / time.Second)
+	a.expiry = new(atomic.Pointer[cachedExpiry]) // not shared with the original
+	return &a
+}
+
+// WithMaxAgeClamp alters the handler so that the max age on the served assets never exceeds
+// the specified ceiling, even if MaxAge is larger. Both the Cache-Control max-age and the
+// Expires header are limited. This helps satisfy proxies that reject very large max-age values.
+// Zero means there is no ceiling, which is the default.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithMaxAgeClamp(ceiling time.Duration) *Assets {
+	if ceiling < 0 {
+		panic("Negative maxAge clamp")
+	}
+	a.maxAgeClamp = ceiling
+	a.expiry = new(atomic.Pointer[cachedExpiry]) // not shared with the original
+	return &a
+}
+
+// WithExpiresThreshold alters the handler so that the Expires header is omitted when the max age
+// exceeds the specified threshold (e.g. one year), relying solely on the Cache-Control max-age,
+// which takes precedence in browsers anyway. This avoids far-future dates in responses for
+// long-lived assets. Zero means Expires is always sent, which is the default.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithExpiresThreshold(threshold time.Duration) *Assets {
+	if threshold < 0 {
+		panic("Negative expires threshold")
+	}
+	a.expiresThreshold = threshold
+	return &a
+}
+
+// WithExpiresForHTTP1Only alters the handler so that the Expires header is omitted for HTTP/2 and
+// later requests. Cache-Control max-age is authoritative for all modern clients, so Expires is
+// only needed for old HTTP/1.0 caches; omitting it saves a few header bytes on each response.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithExpiresForHTTP1Only() *Assets {
+	a.expiresHTTP1Only = true
 	return &a
 }
 
@@ -142,7 +271,10 @@ func (a Assets) WithNotFound(notFound http.Handler) *Assets {
 
 // WithMethodNotAllowed alters the handler so that 405-method not allowed cases are passed
 // to a specified handler. Without this, the default handler is like the one provided in the
-// net/http package (see http.NotFound).
+// net/http package (see http.NotFound), with an Allow header added.
+//
+// HEAD requests are always allowed, so they are never passed to this handler; it can always
+// write a response body.
 //
 // The returned handler is a new copy of the original one.
 func (a Assets) WithMethodNotAllowed(notAllowed http.Handler) *Assets {
@@ -150,6 +282,559 @@ func (a Assets) WithMethodNotAllowed(notAllowed http.Handler) *Assets {
 	return &a
 }
 
+// WithNotFoundText alters the handler so that the plain-text body of 404-not found responses is
+// the specified text instead of the default. This is simpler than providing a NotFound handler
+// when only the message needs to change; the status code and content type are unaltered.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithNotFoundText(text string) *Assets {
+	a.errorText = withErrorText(a.errorText, NotFound, text)
+	return &a
+}
+
+// WithForbiddenText alters the handler so that the plain-text body of 403-forbidden responses is
+// the specified text instead of the default.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithForbiddenText(text string) *Assets {
+	a.errorText = withErrorText(a.errorText, Forbidden, text)
+	return &a
+}
+
+// WithServiceUnavailableText alters the handler so that the plain-text body of 503-service
+// unavailable responses is the specified text instead of the default.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithServiceUnavailableText(text string) *Assets {
+	a.errorText = withErrorText(a.errorText, ServiceUnavailable, text)
+	return &a
+}
+
+// WithServiceUnavailableFile alters the handler so that the body of 503-service unavailable
+// responses is the content of the specified file, e.g. a branded "/503.html" page. The path is
+// relative to the root of the handler's filesystem. The Retry-After header is still set.
+//
+// Because 503 responses typically occur when the server has run out of file descriptors, the file
+// is read now and kept in memory. This method panics if the file cannot be read.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithServiceUnavailableFile(path string) *Assets {
+	body, err := fs.ReadFile(a.fs, removeLeadingSlash(path))
+	if err != nil {
+		panic(fmt.Sprintf("Service unavailable file %s: %v", path, err))
+	}
+
+	m := make(map[code]errorPage, len(a.errorPages)+1)
+	for k, v := range a.errorPages {
+		m[k] = v
+	}
+	contentType := a.contentType(path)
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	m[ServiceUnavailable] = errorPage{contentType: contentType, body: body}
+	a.errorPages = m
+	return &a
+}
+
+// errorPage is a complete response body used in place of the plain-text error message.
+type errorPage struct {
+	contentType string
+	body        []byte
+}
+
+// withErrorText copies the map so that the original handler is not altered.
+func withErrorText(original map[code]string, status code, text string) map[code]string {
+	m := make(map[code]string, len(original)+1)
+	for k, v := range original {
+		m[k] = v
+	}
+	m[status] = text
+	return m
+}
+
+// WithSunset alters the handler so that the specified assets are marked as being scheduled for
+// removal. When one of them is served, the response has "Deprecation: true" and a "Sunset" header
+// giving the removal time (see RFC8594). The map keys are the asset paths (after any prefix
+// segments have been stripped off), e.g. "/schemas/v1.json".
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithSunset(sunset map[string]time.Time) *Assets {
+	a.sunset = make(map[string]time.Time, len(sunset))
+	for p, t := range sunset {
+		a.sunset["/"+removeLeadingSlash(p)] = t
+	}
+	return &a
+}
+
+// WithAliasMap alters the handler so that specified URL paths are served from arbitrary files,
+// regardless of the usual mapping from URL paths to the filesystem. The map keys are the asset
+// paths (after any prefix segments have been stripped off), e.g. "/brand/logo", and the values
+// are the file paths relative to the assets root, e.g. "shared/assets/acme-logo-v3.png".
+// Compressed variants of the mapped files are served in the usual way, and the cache headers
+// and ETags are applied to them as normal.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithAliasMap(aliases map[string]string) *Assets {
+	a.aliases = make(map[string]string, len(aliases))
+	for p, file := range aliases {
+		a.aliases["/"+removeLeadingSlash(p)] = "/" + removeLeadingSlash(file)
+	}
+	return &a
+}
+
+// WithLegalBlock alters the handler so that the specified assets receive a 451-unavailable for
+// legal reasons response (see RFC7725). The map keys are the asset paths (after any prefix segments
+// have been stripped off), e.g. "/media/film.mp4", and the values are the URLs of the authorities
+// that imposed the blocks; these are given in a Link header with rel="blocked-by". A blank value
+// means there is no Link header. The block applies however the asset is requested, e.g. via an
+// alias or the identity suffix, and its compressed variants are blocked too.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithLegalBlock(blocks map[string]string) *Assets {
+	a.legalBlocks = make(map[string]string, len(blocks))
+	for p, authority := range blocks {
+		a.legalBlocks["/"+removeLeadingSlash(p)] = authority
+	}
+	return &a
+}
+
+// WithHealthPath alters the handler so that GET and HEAD requests for exactly the specified
+// URL path (e.g. "/health") receive a 200-OK response with no body. This bypasses all filesystem
+// access, so it is a cheap way for load balancers to check the server. The path is matched before
+// any prefix segments are stripped off.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithHealthPath(path string) *Assets {
+	a.healthPath = path
+	return &a
+}
+
+// WithBuildToken alters the handler so that every response carries an "X-Build" header containing
+// the token, which would typically be the build version. Clients that send the same token back in
+// an "X-If-None-Build" request header receive a 304-not modified response for any asset that
+// exists, without it being read. Responses therefore vary by "X-If-None-Build". This complements
+// the per-file ETags. Responses that are never cached, i.e. HTML pages with a nonce (see
+// WithCSPNonce) and identity requests (see WithIdentitySuffix), are always sent in full.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithBuildToken(token string) *Assets {
+	a.buildToken = token
+	return &a
+}
+
+// WithNotFoundRetry alters the handler so that when a requested file is not found, the handler
+// pauses for the delay and then looks again, up to the specified number of times, before giving
+// a 404-not found response. This smooths over deployments that atomically rename new files over
+// old ones, during which a file might briefly appear not to exist. Compressed variants are not
+// retried.
+//
+// Every genuine 404 response is delayed by the count multiplied by the delay, so both should be
+// small, e.g. 1 and 10ms. Zero count disables retrying, which is the default.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithNotFoundRetry(count int, delay time.Duration) *Assets {
+	if count < 0 {
+		panic("Negative retry count")
+	}
+	if delay < 0 {
+		panic("Negative retry delay")
+	}
+	a.notFoundRetries = count
+	a.notFoundRetryDelay = delay
+	return &a
+}
+
+// WithListingForPrefix alters the handler so that directory listings are enabled or disabled for
+// directories below the specified prefix, e.g. "/public/downloads/", overriding DisableDirListing.
+// When several prefixes match a directory, the longest one wins. As with DisableDirListing, an
+// index.html file is always served for its directory path. Where listings are disabled, a
+// directory requested without its trailing slash receives a 404-not found response, or a redirect
+// to the trailing slash if it has an index.html file.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithListingForPrefix(prefix string, enabled bool) *Assets {
+	prefix = strings.TrimSuffix("/"+strings.Trim(prefix, "/"), "/") + "/"
+	rules := make([]listingRule, len(a.listingRules), len(a.listingRules)+1)
+	copy(rules, a.listingRules)
+	a.listingRules = append(rules, listingRule{prefix: prefix, enabled: enabled})
+	return &a
+}
+
+type listingRule struct {
+	prefix  string
+	enabled bool
+}
+
+// WithTrailingSlashRedirect alters the handler so that a request for a file with a trailing slash,
+// e.g. "/css/style.css/", is redirected to the canonical form without the trailing slash. Without
+// this, such requests receive a 404-not found response.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithTrailingSlashRedirect() *Assets {
+	a.redirectTrailingSlash = true
+	return &a
+}
+
+// WithoutStdlibRedirects alters the handler so that the standard library never redirects a
+// request. Files are served directly, instead of via http.FileServer, so a request for
+// "/index.html" receives the file. Any other redirect from http.FileServer is replaced with a
+// 404-not found response. This ensures that a Location header can never contain the rewritten
+// path, e.g. after StripOff has removed some path segments.
+//
+// Redirects requested explicitly, e.g. via WithTrailingSlashRedirect, are not affected.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithoutStdlibRedirects() *Assets {
+	a.noStdlibRedirects = true
+	return &a
+}
+
+// WithIndexRedirect alters the handler so that a request for a directory path without a trailing
+// slash (e.g. "/docs") is redirected to the same path with the trailing slash (e.g. "/docs/") if
+// the directory has an index.html file. This is needed for relative links in the index page to
+// work. Without this, the index page is served in place.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithIndexRedirect() *Assets {
+	a.indexRedirect = true
+	return &a
+}
+
+// WithCacheBypassHeader alters the handler so that, when a request includes the named header,
+// the response has "Cache-Control: no-store" instead of the usual Expires and Cache-Control
+// headers. This allows tooling to inspect the live files without them being cached.
+//
+// Security note: the header value is not checked, so any client can bypass caching this way.
+// Only use this on trusted internal networks, or ensure that the header is stripped from
+// untrusted requests by a proxy in front of the server.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithCacheBypassHeader(name string) *Assets {
+	a.cacheBypassHeader = http.CanonicalHeaderKey(name)
+	return &a
+}
+
+// WithMaxFileSize alters the handler so that files larger than the specified number of bytes
+// are not served; a 404-not found response is given instead. This guards against large files
+// being misplaced in the asset tree; these should be served by a dedicated download service
+// instead. The limit applies to the file actually served, so a compressed variant may be served
+// even when its original file exceeds the limit. Zero means unlimited, which is the default.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithMaxFileSize(n int64) *Assets {
+	if n < 0 {
+		panic("Negative max file size")
+	}
+	a.maxFileSize = n
+	return &a
+}
+
+// WithoutCompressionForHTTP10 alters the handler so that HTTP/1.0 requests always receive the
+// identity (i.e. uncompressed) files, regardless of their Accept-Encoding header. This safeguards
+// against very old intermediaries that mishandle Content-Encoding.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithoutCompressionForHTTP10() *Assets {
+	a.noCompressionHTTP10 = true
+	return &a
+}
+
+// WithCompressionDecider alters the handler so that the decider function is called for each
+// request to decide whether compressed variants may be served. When it returns false, the request
+// receives the identity (i.e. uncompressed) file, regardless of its Accept-Encoding header. For
+// example, requests from a particular proxy might be identified by a header.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithCompressionDecider(decider func(*http.Request) bool) *Assets {
+	a.compressionDecider = decider
+	return &a
+}
+
+// WithNetworkAwareCompression alters the handler so that the function is called for each request
+// to choose its preferred content encoding, e.g. "gzip" or "br". This is typically based on the
+// client hints about network quality, such as the "ECT" (effective connection type) and "Downlink"
+// headers. The preferred encoding is tried first, provided the client accepts it; otherwise, or if
+// the function returns "", the normal order of preference is used.
+//
+// For example, on very slow connections, the encoding that gives the smallest files for a site
+// might be preferred. The headers that the function uses should also be given to WithExtraVary.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithNetworkAwareCompression(preferred func(*http.Request) string) *Assets {
+	a.preferredEncoding = preferred
+	return &a
+}
+
+// WithVaryCookie alters the handler for assets whose content depends on a cookie, e.g. per-user
+// theme stylesheets. "Cookie" is added to the Vary header of successful responses and the
+// Cache-Control header always has "private" instead of "public". This prevents one user's assets
+// being served to another user by a shared cache.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithVaryCookie() *Assets {
+	a.varyCookie = true
+	a.extraVary = append(append([]string(nil), a.extraVary...), "Cookie")
+	return &a
+}
+
+// WithExtensionRewrite alters the handler so that requested file extensions are mapped to other
+// extensions in the filesystem. The map keys are the extensions in URLs and the values are the
+// extensions of the files, both including the leading dot, e.g. ".html" to ".htm" means that
+// "/about.html" is served from the file "about.htm". The content type is still based on the
+// requested name.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithExtensionRewrite(rewrites map[string]string) *Assets {
+	m := make(map[string]string, len(a.extensionRewrites)+len(rewrites))
+	for urlExt, fsExt := range a.extensionRewrites {
+		m[urlExt] = fsExt
+	}
+	for urlExt, fsExt := range rewrites {
+		m["."+strings.TrimPrefix(strings.ToLower(urlExt), ".")] = "." + strings.TrimPrefix(fsExt, ".")
+	}
+	a.extensionRewrites = m
+	return &a
+}
+
+// WithContentTypes alters the handler so that the specified file extensions have the specified
+// content types, overriding those provided by the mime package. The map keys are the extensions,
+// including the leading dot, e.g. ".wasm". The content type applies to the compressed variants too,
+// e.g. "app.wasm.gz" served with gzip encoding has the content type of ".wasm".
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithContentTypes(types map[string]string) *Assets {
+	m := make(map[string]string, len(a.contentTypes)+len(types))
+	for ext, t := range a.contentTypes {
+		m[ext] = t
+	}
+	for ext, t := range types {
+		m["."+strings.TrimPrefix(strings.ToLower(ext), ".")] = t
+	}
+	a.contentTypes = m
+	return &a
+}
+
+// WithContentSecurityPolicy alters the handler so that HTML responses have a
+// Content-Security-Policy header with the specified policy. This includes directory listings,
+// which contain no inline scripts or styles so they are compatible with a strict policy. Other
+// assets, such as stylesheets and images, do not get the header.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithContentSecurityPolicy(policy string) *Assets {
+	a.contentSecurityPolicy = policy
+	return &a
+}
+
+// WithPermissionsPolicy alters the handler so that HTML responses have a Permissions-Policy header
+// (formerly Feature-Policy) with the specified value, e.g. "camera=(), geolocation=()". Other
+// assets do not get the header because browsers only use it for documents.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithPermissionsPolicy(policy string) *Assets {
+	a.permissionsPolicy = policy
+	return &a
+}
+
+// WithCrossOriginIsolation alters the handler so that HTML documents are cross-origin isolated,
+// which browsers require before they allow SharedArrayBuffer, e.g. for WebAssembly threads. HTML
+// responses have "Cross-Origin-Opener-Policy: same-origin" and "Cross-Origin-Embedder-Policy:
+// require-corp". All other assets have "Cross-Origin-Resource-Policy: cross-origin" so that they
+// can be embedded by isolated documents, including those of other sites.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithCrossOriginIsolation() *Assets {
+	a.crossOriginIsolation = true
+	return &a
+}
+
+// WithAuthorize alters the handler so that the authorize function is called for every GET and
+// HEAD request before anything else is done. When it returns false, the request is passed to the
+// unauthorized handler, or if that is nil, it receives a 401-unauthorized response. This is
+// intended for simple cases, e.g. checking a session cookie, that do not need a full middleware
+// stack. The health path, if any, is not subject to authorization.
+//
+// The unauthorized handler might, for example, redirect to a login page. A 401 response should
+// have a WWW-Authenticate header, which the unauthorized handler would need to set.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithAuthorize(authorize func(*http.Request) bool, unauthorized http.Handler) *Assets {
+	a.authorize = authorize
+	a.unauthorized = unauthorized
+	return &a
+}
+
+// WithAllowedHosts alters the handler so that only requests for the specified host names are
+// served; any other requests receive a 421-misdirected request response. This prevents one
+// tenant's assets being served under another tenant's host name, e.g. due to HTTP/2 connection
+// coalescing. Host names are matched case-insensitively, ignoring any port number.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithAllowedHosts(hosts []string) *Assets {
+	a.allowedHosts = make(List[string], len(hosts))
+	for i, h := range hosts {
+		a.allowedHosts[i] = hostname(h)
+	}
+	return &a
+}
+
+// WithWeakETagsOnly alters the handler so that all ETags are weak, including those for identity
+// (i.e. uncompressed) files, which would otherwise be strong. This is appropriate behind a proxy
+// that may alter the byte stream, e.g. by recompressing it, which would make strong ETags invalid.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithWeakETagsOnly() *Assets {
+	a.weakETagsOnly = true
+	return &a
+}
+
+// WithAutoHeadForHandlers alters the handler so that, for HEAD requests, any response body written
+// by the NotFound handler is discarded; its headers and status code are kept. The handler can then
+// treat HEAD exactly like GET. (This is not needed for the MethodNotAllowed handler because HEAD
+// requests never reach it.)
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithAutoHeadForHandlers() *Assets {
+	a.autoHead = true
+	return &a
+}
+
+// WithNoContentForEmptyHead alters the handler so that a HEAD request for a zero-length file gets
+// a 204-no content response instead of 200-OK with "Content-Length: 0". This suits monitoring that
+// expects 204 for an intentionally empty asset, such as a keep-alive probe. GET requests and
+// non-empty files are unaffected.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithNoContentForEmptyHead() *Assets {
+	a.emptyHeadNoContent = true
+	return &a
+}
+
+// WithResolvedPathHeader alters the handler so that successful responses have an X-Resolved-Path
+// header giving the path of the file, relative to the root of the handler's filesystem, that was
+// chosen after prefix stripping, aliases, rewrites and content negotiation, e.g.
+// "/css/style.css.gz". This helps when debugging complex configurations. Because it reveals the
+// internal layout of the filesystem, it should not normally be used in production.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithResolvedPathHeader() *Assets {
+	a.resolvedPathHeader = true
+	return &a
+}
+
+// WithSlowServeLog alters the handler so that any request that takes longer than the threshold to
+// serve is logged via Debugf, giving the method, path and duration. This helps to find
+// pathological files or a degraded filesystem. Note that the duration includes the time taken to
+// write the response, so slow clients may also be reported. Zero disables this, which is the
+// default.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithSlowServeLog(threshold time.Duration) *Assets {
+	if threshold < 0 {
+		panic("Negative slow serve threshold")
+	}
+	a.slowServeThreshold = threshold
+	return &a
+}
+
+// WithExtraVary alters the handler so that the specified header field names are added to the Vary
+// header of successful responses, merged with the ones added automatically (e.g. Accept-Encoding).
+// This allows caches to key the responses correctly when an upstream proxy varies the content by
+// some other header, e.g. "X-Tenant".
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithExtraVary(fields ...string) *Assets {
+	a.extraVary = append(append([]string(nil), a.extraVary...), fields...)
+	return &a
+}
+
+// WithNoTransform alters the handler so that compressed responses have "no-transform" in their
+// Cache-Control header (see RFC9111). This tells intermediaries, such as misconfigured transparent
+// proxies, not to alter the encoded body or strip its Content-Encoding header.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithNoTransform() *Assets {
+	a.noTransform = true
+	return &a
+}
+
+// WithCanonicalEncodingVary alters the handler so that each response has an "X-Encoding-Bucket"
+// header giving the content encoding that was chosen: "br", "gzip" or "identity". Responses still
+// have "Vary: Accept-Encoding" as usual. Clients send many different Accept-Encoding values that
+// lead to the same choice (e.g. "gzip, deflate, br" and "br, gzip"), which fragments shared
+// caches that key on the whole header. A cache that can be configured to key on this header
+// instead, or that normalises Accept-Encoding into these buckets itself, gets better hit rates.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithCanonicalEncodingVary() *Assets {
+	a.encodingBucket = true
+	return &a
+}
+
+// WithEnabledEncodings alters the handler so that it only looks for the compressed variants with
+// the specified encodings, which are "br", "gzip" and/or "dcz" (see WithZstdDictionary). For
+// example, a deployment that only produces brotli files would use WithEnabledEncodings("br") so
+// that the handler never looks for ".gz" files, saving a filesystem access on every request. With
+// no encodings, compressed variants are never served. This method panics if an encoding is not
+// supported.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithEnabledEncodings(encodings ...string) *Assets {
+	a.enabledEncodings = make(List[string], 0, len(encodings))
+	for _, enc := range encodings {
+		if enc != dictionaryEncoding && !slices.ContainsFunc(compressedVariants, func(v compressedVariant) bool { return v.encoding == enc }) {
+			panic("Unsupported encoding " + enc)
+		}
+		a.enabledEncodings = append(a.enabledEncodings, enc)
+	}
+	return &a
+}
+
+// WithOriginalLastModified alters the handler so that the Last-Modified header of compressed
+// responses gives the modification time of the original file, instead of the compressed file
+// actually served. If-Modified-Since conditional requests are then evaluated against the original
+// file too, so that they reflect the logical asset. This needs an extra filesystem access for each
+// compressed response.
+//
+// By default, the modification time of the file actually served is used, because the compressed
+// file is normally created after (or at the same time as) the original one.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithOriginalLastModified() *Assets {
+	a.originalLastModified = true
+	return &a
+}
+
+// WithMinCompressionRatio alters the handler so that a compressed variant is only served if it
+// is smaller than the original file by at least the specified fraction, e.g. 0.15 requires a
+// saving of at least 15%. Otherwise, the next preferred variant is tried, and then the original
+// file. This avoids clients spending CPU time decoding for negligible gains. It needs an extra
+// filesystem access for each compressed response. Zero disables this check, which is the default.
+// This method panics if the ratio is not between zero and one.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithMinCompressionRatio(ratio float64) *Assets {
+	if ratio < 0 || ratio >= 1 {
+		panic("Compression ratio must be from zero to less than one")
+	}
+	a.minCompressionRatio = ratio
+	return &a
+}
+
+// WithAcceptRanges alters the handler so that the Accept-Ranges header is set explicitly on every
+// asset served. Identity (i.e. uncompressed) responses get "Accept-Ranges: bytes" and compressed
+// responses get "Accept-Ranges: none". Without this, the standard library advertises "bytes" for
+// all responses, compressed or not.
+//
+// This only advertises the range capability; it doesn't change how range requests are actually
+// handled, which is done by the standard library.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithAcceptRanges() *Assets {
+	a.acceptRanges = true
+	return &a
+}
+
 //-------------------------------------------------------------------------------------------------
 
 // Printer is something that allows formatted printing. This is only used for diagnostics.
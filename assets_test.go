@@ -23,7 +23,13 @@
 package servefiles
 
 import (
+	"archive/zip"
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
+	"io/fs"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	. "net/url"
@@ -31,8 +37,10 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
+	"github.com/rickb777/servefiles/v3/afero2"
 	"github.com/spf13/afero"
 )
 
@@ -88,10 +96,11 @@ func TestChooseResourceDirListingIsNotAllowed(t *testing.T) {
 		maxAge       time.Duration
 		method, url  string
 		cacheControl string
+		conLen       string
 		body         int
 	}{
-		{maxAge: 1, method: "GET", url: "/css/", cacheControl: "public, max-age=1", body: 14},
-		{maxAge: 1, method: "HEAD", url: "/css/", cacheControl: "public, max-age=1", body: 0},
+		{maxAge: 1, method: "GET", url: "/css/", cacheControl: "public, max-age=1", conLen: "14", body: 14},
+		{maxAge: 1, method: "HEAD", url: "/css/", cacheControl: "public, max-age=1", conLen: "", body: 0},
 	}
 
 	for i, test := range cases {
@@ -107,6 +116,7 @@ func TestChooseResourceDirListingIsNotAllowed(t *testing.T) {
 		isEqual(t, len(w.Header()["Expires"]), 0, i)
 		isEqual(t, len(w.Header()["Cache-Control"]), 0, i)
 		isEqual(t, len(w.Header()["Etag"]), 0, i)
+		isEqual(t, w.Header().Get("Content-Length"), test.conLen, i)
 		isEqual(t, w.Body.Len(), test.body, i)
 	}
 }
@@ -205,13 +215,43 @@ func TestChooseResourceSimpleNonExistent(t *testing.T) {
 
 		isEqual(t, w.Code, http.StatusNotFound, i)
 		//t.Logf("header %v", w.Header())
-		isGte(t, len(w.Header()), 4, i)
+		isGte(t, len(w.Header()), 5, i)
 		isEqual(t, w.Header().Get("Content-Type"), "text/plain; charset=utf-8", i)
+		isEqual(t, w.Header().Get("Content-Length"), "14", i)
 		isEqual(t, w.Header().Get("Cache-Control"), "public, max-age=1", i)
 		isGte(t, len(w.Header().Get("Expires")), 25, i)
 	}
 }
 
+func TestServeHTTPWithFewerSegmentsThanStripOff(t *testing.T) {
+	cases := []struct {
+		path string
+		code int
+		body string
+	}{
+		{path: "/a/b", code: 404, body: "404 Not found\n"},
+		{path: "/a/b/", code: 404, body: "404 Not found\n"},
+		{path: "/a//b/c/js/script1.js", code: 404, body: "404 Not found\n"},
+		{path: "/a", code: 404, body: "404 Not found\n"},
+		{path: "/", code: 404, body: "404 Not found\n"},
+		{path: "/a/b/c", code: 200, body: "<html><body>index page</body></html>"},
+		{path: "/a/b/c/", code: 200, body: "<html><body>index page</body></html>"},
+		{path: "/a/b/c/js/script1.js", code: 200, body: "function foo() {\n}\n"},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.path, nil)
+		a := NewAssetHandler("./assets/").StripOff(3)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Location"), "", i)
+		isEqual(t, w.Body.String(), test.body, i)
+	}
+}
+
 func TestServeHTTP200WithGzipAndGzipWithAcceptHeader(t *testing.T) {
 	cases := []struct {
 		n                                       int
@@ -271,188 +311,1854 @@ func TestServeHTTP200WithBrAndBrWithAcceptHeader(t *testing.T) {
 
 		a.ServeHTTP(w, request)
 
-		isEqual(t, w.Code, http.StatusOK, test.path)
-		headers := w.Header()
-		//t.Logf("%+v\n", headers)
-		isGte(t, len(headers), 7, test.path)
-		isEqual(t, headers["Cache-Control"], []string{test.cacheControl}, test.path)
-		isEqual(t, headers["Content-Type"], []string{test.mime}, test.path)
-		isEqual(t, headers["X-Content-Type-Options"], []string{"nosniff"}, test.path)
-		isEqual(t, headers["Content-Encoding"], []string{"br"}, test.path)
-		isEqual(t, headers["Vary"], []string{"Accept-Encoding"}, test.path)
-		isEqual(t, headers["Etag"], []string{"W/" + etag}, test.path)
-		isEqual(t, len(headers["Expires"]), 1, test.path)
-		isGte(t, len(headers["Expires"][0]), 25, test.path)
+		isEqual(t, w.Code, http.StatusOK, test.path)
+		headers := w.Header()
+		//t.Logf("%+v\n", headers)
+		isGte(t, len(headers), 7, test.path)
+		isEqual(t, headers["Cache-Control"], []string{test.cacheControl}, test.path)
+		isEqual(t, headers["Content-Type"], []string{test.mime}, test.path)
+		isEqual(t, headers["X-Content-Type-Options"], []string{"nosniff"}, test.path)
+		isEqual(t, headers["Content-Encoding"], []string{"br"}, test.path)
+		isEqual(t, headers["Vary"], []string{"Accept-Encoding"}, test.path)
+		isEqual(t, headers["Etag"], []string{"W/" + etag}, test.path)
+		isEqual(t, len(headers["Expires"]), 1, test.path)
+		isGte(t, len(headers["Expires"][0]), 25, test.path)
+	}
+}
+
+func TestServeHTTP200WithMultipleAcceptHeaderLines(t *testing.T) {
+	cases := []struct {
+		url      string
+		encoding []string
+		conEnc   string
+	}{
+		{url: "/css/style1.css", encoding: []string{"xx", "br"}, conEnc: "br"},
+		{url: "/css/style1.css", encoding: []string{"xx", "gzip, zzz"}, conEnc: "gzip"},
+		{url: "/css/style1.css", encoding: []string{"gzip", "br"}, conEnc: "br"},
+		{url: "/css/style2.css", encoding: []string{"br", "gzip"}, conEnc: ""},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		request.Header["Accept-Encoding"] = test.encoding
+		a := NewAssetHandler("./assets/")
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Content-Encoding"), test.conEnc, i)
+	}
+}
+
+func TestServeHTTP200WithGzipButNoAcceptHeader(t *testing.T) {
+	cases := []struct {
+		n                                       int
+		maxAge                                  time.Duration
+		url, mime, encoding, path, cacheControl string
+	}{
+		{0, 1, "/css/style1.css", cssMimeType, "xx, yy, zzz", "assets/css/style1.css", "public, max-age=1"},
+		{2, 2, "/a/b/css/style1.css", cssMimeType, "xx, yy, zzz", "assets/css/style1.css", "public, max-age=2"},
+		{0, 3, "/js/script1.js", javascriptMimeType, "xx, yy, zzz", "assets/js/script1.js", "public, max-age=3"},
+		{2, 4, "/a/b/js/script1.js", javascriptMimeType, "xx, yy, zzz", "assets/js/script1.js", "public, max-age=4"},
+	}
+
+	for _, test := range cases {
+		etag := etagFor(test.path)
+		url := mustUrl(test.url)
+		header := newHeader("Accept-Encoding", test.encoding)
+		request := &http.Request{Method: "GET", URL: url, Header: header}
+		a := NewAssetHandler("./assets/").StripOff(test.n).WithMaxAge(test.maxAge * time.Second)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, test.path)
+		headers := w.Header()
+		//t.Logf("%+v\n", headers)
+		isGte(t, len(headers), 6, test.path)
+		isEqual(t, headers["Cache-Control"], []string{test.cacheControl}, test.path)
+		isEqual(t, headers["Content-Type"], []string{test.mime}, test.path)
+		isEqual(t, headers["Content-Encoding"], emptyStrings, test.path)
+		isEqual(t, headers["Vary"], emptyStrings, test.path)
+		isEqual(t, headers["Etag"], []string{etag}, test.path)
+		isEqual(t, len(headers["Expires"]), 1, test.path)
+		isGte(t, len(headers["Expires"][0]), 25, test.path)
+	}
+}
+
+func TestServeHTTP200WithGzipAcceptHeaderButNoGzippedFile(t *testing.T) {
+	cases := []struct {
+		n                                       int
+		maxAge                                  time.Duration
+		url, mime, encoding, path, cacheControl string
+	}{
+		{0, 1, "/css/style2.css", cssMimeType, "xx, gzip, zzz", "assets/css/style2.css", "public, max-age=1"},
+		{0, 1, "/css/style2.css", cssMimeType, "br, gzip, zzz", "assets/css/style2.css", "public, max-age=1"},
+		{2, 2, "/a/b/css/style2.css", cssMimeType, "xx, gzip, zzz", "assets/css/style2.css", "public, max-age=2"},
+		{2, 2, "/a/b/css/style2.css", cssMimeType, "br, gzip, zzz", "assets/css/style2.css", "public, max-age=2"},
+		{0, 3, "/js/script2.js", javascriptMimeType, "xx, gzip, zzz", "assets/js/script2.js", "public, max-age=3"},
+		{0, 3, "/js/script2.js", javascriptMimeType, "br, gzip, zzz", "assets/js/script2.js", "public, max-age=3"},
+		{2, 4, "/a/b/js/script2.js", javascriptMimeType, "xx, gzip, zzz", "assets/js/script2.js", "public, max-age=4"},
+		{2, 4, "/a/b/js/script2.js", javascriptMimeType, "br, gzip, zzz", "assets/js/script2.js", "public, max-age=4"},
+		{0, 5, "/img/sort_asc.png", "image/png", "xx, gzip, zzz", "assets/img/sort_asc.png", "public, max-age=5"},
+		{0, 5, "/img/sort_asc.png", "image/png", "br, gzip, zzz", "assets/img/sort_asc.png", "public, max-age=5"},
+		{2, 6, "/a/b/img/sort_asc.png", "image/png", "xx, gzip, zzz", "assets/img/sort_asc.png", "public, max-age=6"},
+		{2, 6, "/a/b/img/sort_asc.png", "image/png", "br, gzip, zzz", "assets/img/sort_asc.png", "public, max-age=6"},
+	}
+
+	for _, test := range cases {
+		etag := etagFor(test.path)
+		url := mustUrl(test.url)
+		header := newHeader("Accept-Encoding", test.encoding)
+		request := &http.Request{Method: "GET", URL: url, Header: header}
+		a := NewAssetHandler("./assets/").StripOff(test.n).WithMaxAge(test.maxAge * time.Second)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, test.path)
+		headers := w.Header()
+		//t.Logf("%+v\n", headers)
+		isGte(t, len(headers), 6, test.path)
+		isEqual(t, headers["Cache-Control"], []string{test.cacheControl}, test.path)
+		isEqual(t, headers["Content-Type"], []string{test.mime}, test.path)
+		isEqual(t, headers["Content-Encoding"], emptyStrings, test.path)
+		isEqual(t, headers["Vary"], emptyStrings, test.path)
+		isEqual(t, headers["Etag"], []string{etag}, test.path)
+		isEqual(t, len(headers["Expires"]), 1, test.path)
+		isGte(t, len(headers["Expires"][0]), 25, test.path)
+	}
+}
+
+func TestServeHTTPWithAcceptRanges(t *testing.T) {
+	cases := []struct {
+		url, encoding, acceptRanges string
+		enabled                     bool
+	}{
+		{url: "/css/style1.css", encoding: "gzip", acceptRanges: "none", enabled: true},
+		{url: "/css/style1.css", encoding: "br", acceptRanges: "none", enabled: true},
+		{url: "/css/style1.css", encoding: "xx", acceptRanges: "bytes", enabled: true},
+		{url: "/img/sort_asc.png", encoding: "gzip", acceptRanges: "bytes", enabled: true},
+		{url: "/css/style1.css", encoding: "gzip", acceptRanges: "bytes", enabled: false}, // standard library default
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		a := NewAssetHandler("./assets/")
+		if test.enabled {
+			a = a.WithAcceptRanges()
+		}
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Accept-Ranges"), test.acceptRanges, i)
+	}
+}
+
+func TestServeHTTPWithSunset(t *testing.T) {
+	sunset := time.Date(2030, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		n                   int
+		url, encoding       string
+		deprecation, sunset string
+	}{
+		{url: "/js/script1.js", encoding: "xx", deprecation: "true", sunset: "Sun, 30 Jun 2030 12:00:00 GMT"},
+		{url: "/js/script1.js", encoding: "gzip", deprecation: "true", sunset: "Sun, 30 Jun 2030 12:00:00 GMT"},
+		{n: 1, url: "/a/js/script1.js", encoding: "xx", deprecation: "true", sunset: "Sun, 30 Jun 2030 12:00:00 GMT"},
+		{url: "/js/script2.js", encoding: "xx"},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		a := NewAssetHandler("./assets/").StripOff(test.n).WithSunset(map[string]time.Time{"js/script1.js": sunset})
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Deprecation"), test.deprecation, i)
+		isEqual(t, w.Header().Get("Sunset"), test.sunset, i)
+	}
+}
+
+func TestServeHTTPIgnoresQuery(t *testing.T) {
+	cases := []struct {
+		encoding string
+		size     int
+	}{
+		{encoding: "xx", size: 19},
+		{encoding: "gzip", size: 50},
+	}
+
+	a := NewAssetHandler("./assets/").WithMaxAge(time.Hour)
+
+	for i, test := range cases {
+		var etags []string
+		for _, query := range []string{"", "?v=1", "?v=2"} {
+			request, _ := http.NewRequest("GET", "/js/script1.js"+query, nil)
+			request.Header.Set("Accept-Encoding", test.encoding)
+			w := httptest.NewRecorder()
+
+			a.ServeHTTP(w, request)
+
+			isEqual(t, w.Code, http.StatusOK, i)
+			isEqual(t, w.Body.Len(), test.size, i)
+			etags = append(etags, w.Header().Get("ETag"))
+		}
+
+		isEqual(t, etags[1], etags[0], i)
+		isEqual(t, etags[2], etags[0], i)
+	}
+}
+
+func TestServeHTTPWithAliasMap(t *testing.T) {
+	cases := []struct {
+		url, encoding   string
+		code            int
+		contentType     string
+		contentEncoding string
+		size            int
+	}{
+		{url: "/brand/logo", encoding: "xx", code: 200, contentType: "image/png", size: 160},
+		{url: "/brand/style", encoding: "xx", code: 200, contentType: "text/css; charset=utf-8", size: 31},
+		{url: "/brand/style", encoding: "gzip", code: 200, contentType: "text/css; charset=utf-8", contentEncoding: "gzip", size: 60},
+		{url: "/brand/missing", encoding: "xx", code: 404, contentType: "text/plain; charset=utf-8", size: 14},
+		{url: "/img/sort_asc.png", encoding: "xx", code: 200, contentType: "image/png", size: 160},
+	}
+
+	a := NewAssetHandler("./assets/").WithMaxAge(time.Hour).WithAliasMap(map[string]string{
+		"/brand/logo":    "img/sort_asc.png",
+		"brand/style":    "/css/style1.css",
+		"/brand/missing": "img/nothing.png",
+	})
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Content-Type"), test.contentType, i)
+		isEqual(t, w.Header().Get("Content-Encoding"), test.contentEncoding, i)
+		isEqual(t, w.Body.Len(), test.size, i)
+		if test.code == 200 {
+			isEqual(t, w.Header().Get("Cache-Control"), "public, max-age=3600", i)
+			isNotEqual(t, w.Header().Get("ETag"), "", i)
+		}
+	}
+}
+
+func TestServeHTTPWithHealthPath(t *testing.T) {
+	cases := []struct {
+		method, url string
+		code        int
+	}{
+		{method: "HEAD", url: "/health", code: http.StatusOK},
+		{method: "GET", url: "/health", code: http.StatusOK},
+		{method: "GET", url: "/health/x", code: http.StatusNotFound},
+		{method: "POST", url: "/health", code: http.StatusMethodNotAllowed},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest(test.method, test.url, nil)
+		a := NewAssetHandler("./assets/").WithMaxAge(time.Hour).WithHealthPath("/health")
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		if test.code == http.StatusOK {
+			isEqual(t, w.Body.Len(), 0, i)
+			isEqual(t, len(w.Header()), 0, i)
+		}
+	}
+}
+
+func TestServeHTTPWithBuildToken(t *testing.T) {
+	cases := []struct {
+		url, token string
+		code       int
+		body       int
+	}{
+		{url: "/css/style1.css", token: "v1.2.3", code: http.StatusNotModified, body: 0},
+		{url: "/img/nonexisting.png", token: "v1.2.3", code: http.StatusNotFound, body: 14},
+		{url: "/css/style1.css", token: "v1.2.2", code: http.StatusOK, body: 31},
+		{url: "/css/style1.css", token: "", code: http.StatusOK, body: 31},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		if test.token != "" {
+			request.Header.Set("X-If-None-Build", test.token)
+		}
+		a := NewAssetHandler("./assets/").WithMaxAge(time.Hour).WithBuildToken("v1.2.3")
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("X-Build"), "v1.2.3", i)
+		isEqual(t, w.Header().Get("Vary"), "X-If-None-Build", i)
+		if test.code != http.StatusNotFound {
+			isEqual(t, w.Header().Get("Cache-Control"), "public, max-age=3600", i)
+		}
+		isEqual(t, w.Body.Len(), test.body, i)
+	}
+}
+
+func TestServeHTTPFileWithTrailingSlash(t *testing.T) {
+	cases := []struct {
+		n                 int
+		url, encoding     string
+		redirect, disable bool
+		code              int
+		location          string
+	}{
+		{url: "/css/style1.css/", encoding: "gzip", code: http.StatusNotFound},
+		{url: "/css/style2.css/", encoding: "xx", code: http.StatusNotFound},
+		{url: "/css/style2.css/", encoding: "xx", disable: true, code: http.StatusNotFound},
+		{url: "/css/style1.css/", encoding: "gzip", redirect: true, code: http.StatusMovedPermanently, location: "/css/style1.css"},
+		{url: "/css/style2.css/?v=1", encoding: "xx", redirect: true, disable: true, code: http.StatusMovedPermanently, location: "/css/style2.css?v=1"},
+		{n: 1, url: "/a/css/style2.css/", encoding: "xx", redirect: true, code: http.StatusMovedPermanently, location: "/a/css/style2.css"},
+		{url: "/css/", encoding: "gzip", redirect: true, code: http.StatusOK},
+		{url: "/css/", encoding: "gzip", redirect: true, disable: true, code: http.StatusNotFound},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		a := NewAssetHandler("./assets/").StripOff(test.n)
+		a.DisableDirListing = test.disable
+		if test.redirect {
+			a = a.WithTrailingSlashRedirect()
+		}
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Location"), test.location, i)
+		isEqual(t, w.Header().Get("Retry-After"), "", i)
+		isEqual(t, w.Header().Get("Content-Encoding"), "", i)
+	}
+}
+
+func TestServeHTTPWithCacheBypassHeader(t *testing.T) {
+	cases := []struct {
+		url, bypass  string
+		code         int
+		cacheControl string
+		expires      bool
+	}{
+		{url: "/css/style1.css", bypass: "x-no-cache", code: http.StatusOK, cacheControl: "no-store"},
+		{url: "/img/nonexisting.png", bypass: "X-No-Cache", code: http.StatusNotFound, cacheControl: "no-store"},
+		{url: "/css/style1.css", bypass: "", code: http.StatusOK, cacheControl: "public, max-age=3600", expires: true},
+		{url: "/css/style1.css", bypass: "X-Other", code: http.StatusOK, cacheControl: "public, max-age=3600", expires: true},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		if test.bypass != "" {
+			request.Header.Set(test.bypass, "1")
+		}
+		a := NewAssetHandler("./assets/").WithMaxAge(time.Hour).WithCacheBypassHeader("x-no-cache")
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Cache-Control"), test.cacheControl, i)
+		isEqual(t, w.Header().Get("Expires") != "", test.expires, i)
+	}
+}
+
+func TestServeHTTPWithMaxFileSize(t *testing.T) {
+	cases := []struct {
+		url, encoding string
+		max           int64
+		code          int
+	}{
+		{url: "/css/style1.css", encoding: "xx", max: 32, code: http.StatusOK},
+		{url: "/css/style2.css", encoding: "xx", max: 32, code: http.StatusNotFound},
+		{url: "/css/style2.css", encoding: "xx", max: 34, code: http.StatusOK},
+		{url: "/img/sort_asc.png", encoding: "xx", max: 100, code: http.StatusNotFound},
+		{url: "/img/sort_asc.png", encoding: "xx", max: 0, code: http.StatusOK},
+		{url: "/css/style1.css", encoding: "gzip", max: 30, code: http.StatusNotFound},
+		{url: "/css/style1.css", encoding: "gzip", max: 50, code: http.StatusOK}, // identity is served
+		{url: "/css/style1.css", encoding: "gzip", max: 60, code: http.StatusOK},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		a := NewAssetHandler("./assets/").WithMaxFileSize(test.max)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+	}
+}
+
+func TestServeHTTPWithoutCompressionForHTTP10(t *testing.T) {
+	cases := []struct {
+		major, minor int
+		enabled      bool
+		conEnc       string
+	}{
+		{major: 1, minor: 0, enabled: true, conEnc: ""},
+		{major: 1, minor: 1, enabled: true, conEnc: "gzip"},
+		{major: 2, minor: 0, enabled: true, conEnc: "gzip"},
+		{major: 1, minor: 0, enabled: false, conEnc: "gzip"},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+		request.ProtoMajor, request.ProtoMinor = test.major, test.minor
+		request.Header.Set("Accept-Encoding", "gzip")
+		a := NewAssetHandler("./assets/")
+		if test.enabled {
+			a = a.WithoutCompressionForHTTP10()
+		}
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Content-Encoding"), test.conEnc, i)
+	}
+}
+
+func TestServeHTTPWithCompressionDecider(t *testing.T) {
+	cases := []struct {
+		header   string
+		encoding string
+		conEnc   string
+		size     int
+	}{
+		{header: "", encoding: "gzip", conEnc: "gzip", size: 60},
+		{header: "diff", encoding: "gzip", conEnc: "", size: 31},
+		{header: "diff", encoding: "br, gzip", conEnc: "", size: 31},
+		{header: "other", encoding: "br", conEnc: "br", size: 31},
+	}
+
+	a := NewAssetHandler("./assets/").WithCompressionDecider(func(req *http.Request) bool {
+		return req.Header.Get("X-Proxy") != "diff"
+	})
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		if test.header != "" {
+			request.Header.Set("X-Proxy", test.header)
+		}
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Content-Encoding"), test.conEnc, i)
+		isEqual(t, w.Body.Len(), test.size, i)
+	}
+}
+
+func TestServeHTTPWithContentSecurityPolicy(t *testing.T) {
+	const csp = "default-src 'self'"
+
+	cases := []struct {
+		url, encoding string
+		enabled       bool
+		conType, csp  string
+	}{
+		{url: "/css/", encoding: "xx", enabled: true, conType: "text/html; charset=utf-8", csp: csp},
+		{url: "/css/", encoding: "xx", enabled: false, conType: "text/html; charset=utf-8", csp: ""},
+		{url: "/", encoding: "gzip", enabled: true, conType: "text/html; charset=utf-8", csp: csp},
+		{url: "/index.html", encoding: "xx", enabled: true, conType: "", csp: csp}, // redirected to "./"
+		{url: "/css/style1.css", encoding: "xx", enabled: true, conType: cssMimeType, csp: ""},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		a := NewAssetHandler("./assets/")
+		if test.enabled {
+			a = a.WithContentSecurityPolicy(csp)
+		}
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Header().Get("Content-Type"), test.conType, i)
+		isEqual(t, w.Header().Get("Content-Security-Policy"), test.csp, i)
+	}
+}
+
+func TestServeHTTPWithReportingEndpoint(t *testing.T) {
+	cases := []struct {
+		url, csp            string
+		endpoints, expected string
+	}{
+		{url: "/", csp: "default-src 'self'", endpoints: `csp="https://example.com/reports"`, expected: "default-src 'self'; report-to csp"},
+		{url: "/", csp: "default-src 'self';", endpoints: `csp="https://example.com/reports"`, expected: "default-src 'self'; report-to csp"},
+		{url: "/css/", csp: "default-src 'self'", endpoints: `csp="https://example.com/reports"`, expected: "default-src 'self'; report-to csp"},
+		{url: "/", csp: "", endpoints: `csp="https://example.com/reports"`, expected: ""},
+		{url: "/css/style1.css", csp: "default-src 'self'", endpoints: "", expected: ""},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		a := NewAssetHandler("./assets/").WithContentSecurityPolicy(test.csp).WithReportingEndpoint("csp", "https://example.com/reports")
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Reporting-Endpoints"), test.endpoints, i)
+		isEqual(t, w.Header().Get("Content-Security-Policy"), test.expected, i)
+	}
+
+	// combined with a nonce
+	request, _ := http.NewRequest("GET", "/", nil)
+	a := NewAssetHandler("./assets/").WithCSPNonce().WithReportingEndpoint("csp", "https://example.com/reports")
+	w := httptest.NewRecorder()
+
+	a.ServeHTTP(w, request)
+
+	isEqual(t, strings.HasSuffix(w.Header().Get("Content-Security-Policy"), "'; report-to csp"), true, "nonce")
+
+	// only backslashes and double quotes are escaped
+	request, _ = http.NewRequest("GET", "/", nil)
+	a = NewAssetHandler("./assets/").WithReportingEndpoint("csp-endpoint", `https://example.com/r?a="b"&c=\d`)
+	w = httptest.NewRecorder()
+
+	a.ServeHTTP(w, request)
+
+	isEqual(t, w.Header().Get("Reporting-Endpoints"), `csp-endpoint="https://example.com/r?a=\"b\"&c=\\d"`, "escaped")
+}
+
+func TestWithReportingEndpointInvalid(t *testing.T) {
+	cases := []struct {
+		name, url string
+	}{
+		{name: "CSP", url: "https://example.com/reports"},
+		{name: "csp endpoint", url: "https://example.com/reports"},
+		{name: "", url: "https://example.com/reports"},
+		{name: "csp", url: "https://example.com/r\u00e9ports"},
+		{name: "csp", url: "https://example.com/reports\r\nX-Injected: 1"},
+		{name: "csp", url: "https://exa mple.com/reports"},
+	}
+
+	for i, test := range cases {
+		func() {
+			defer func() {
+				isNotEqual(t, recover(), nil, i)
+			}()
+			NewAssetHandler("./assets/").WithReportingEndpoint(test.name, test.url)
+			t.Errorf("expected a panic for %d", i)
+		}()
+	}
+}
+
+func TestServeHTTPWithPermissionsPolicy(t *testing.T) {
+	const policy = "camera=(), geolocation=()"
+
+	cases := []struct {
+		url, encoding string
+		enabled       bool
+		policy        string
+	}{
+		{url: "/", encoding: "gzip", enabled: true, policy: policy},
+		{url: "/", encoding: "xx", enabled: true, policy: policy},
+		{url: "/", encoding: "xx", enabled: false, policy: ""},
+		{url: "/css/", encoding: "xx", enabled: true, policy: policy},
+		{url: "/css/style1.css", encoding: "xx", enabled: true, policy: ""},
+		{url: "/css/style1.css", encoding: "gzip", enabled: true, policy: ""},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		a := NewAssetHandler("./assets/")
+		if test.enabled {
+			a = a.WithPermissionsPolicy(policy)
+		}
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Permissions-Policy"), test.policy, i)
+	}
+}
+
+func TestServeHTTPWithCrossOriginIsolation(t *testing.T) {
+	cases := []struct {
+		url, encoding string
+		enabled       bool
+		coop, coep    string
+		corp          string
+	}{
+		{url: "/", encoding: "gzip", enabled: true, coop: "same-origin", coep: "require-corp"},
+		{url: "/", encoding: "xx", enabled: true, coop: "same-origin", coep: "require-corp"},
+		{url: "/css/", encoding: "xx", enabled: true, coop: "same-origin", coep: "require-corp"},
+		{url: "/css/style1.css", encoding: "gzip", enabled: true, corp: "cross-origin"},
+		{url: "/js/script1.js", encoding: "xx", enabled: true, corp: "cross-origin"},
+		{url: "/", encoding: "xx", enabled: false},
+		{url: "/css/style1.css", encoding: "xx", enabled: false},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		a := NewAssetHandler("./assets/")
+		if test.enabled {
+			a = a.WithCrossOriginIsolation()
+		}
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Cross-Origin-Opener-Policy"), test.coop, i)
+		isEqual(t, w.Header().Get("Cross-Origin-Embedder-Policy"), test.coep, i)
+		isEqual(t, w.Header().Get("Cross-Origin-Resource-Policy"), test.corp, i)
+	}
+}
+
+func TestServeHTTPWithMaxAgeClamp(t *testing.T) {
+	const tenYears = 10 * 365 * 24 * time.Hour
+
+	cases := []struct {
+		maxAge, clamp time.Duration
+		cacheControl  string
+	}{
+		{maxAge: tenYears, clamp: 24 * time.Hour, cacheControl: "public, max-age=86400"},
+		{maxAge: time.Hour, clamp: 24 * time.Hour, cacheControl: "public, max-age=3600"},
+		{maxAge: tenYears, clamp: 0, cacheControl: "public, max-age=315360000"},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+		a := NewAssetHandler("./assets/").WithMaxAge(test.maxAge).WithMaxAgeClamp(test.clamp)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Cache-Control"), test.cacheControl, i)
+
+		expires, err := time.Parse(time.RFC1123, w.Header().Get("Expires"))
+		must(err)
+		effective := min(test.maxAge, test.clamp)
+		if test.clamp == 0 {
+			effective = test.maxAge
+		}
+		remaining := time.Until(expires)
+		isEqual(t, remaining > effective-time.Minute && remaining < effective+effective/50+time.Minute, true, i)
+	}
+}
+
+func TestServeHTTPWithExpiresThreshold(t *testing.T) {
+	const year = 365 * 24 * time.Hour
+
+	cases := []struct {
+		maxAge, threshold time.Duration
+		expires           bool
+	}{
+		{maxAge: 10 * year, threshold: year, expires: false},
+		{maxAge: year, threshold: year, expires: true},
+		{maxAge: time.Hour, threshold: year, expires: true},
+		{maxAge: 10 * year, threshold: 0, expires: true},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+		a := NewAssetHandler("./assets/").WithMaxAge(test.maxAge).WithExpiresThreshold(test.threshold)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Cache-Control"), fmt.Sprintf("public, max-age=%d", int(test.maxAge/time.Second)), i)
+		isEqual(t, w.Header().Get("Expires") != "", test.expires, i)
+	}
+}
+
+func TestServeHTTPWithExpiresForHTTP1Only(t *testing.T) {
+	cases := []struct {
+		major, minor int
+		http1Only    bool
+		expires      bool
+	}{
+		{major: 2, minor: 0, http1Only: true, expires: false},
+		{major: 3, minor: 0, http1Only: true, expires: false},
+		{major: 1, minor: 1, http1Only: true, expires: true},
+		{major: 1, minor: 0, http1Only: true, expires: true},
+		{major: 2, minor: 0, http1Only: false, expires: true},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+		request.ProtoMajor, request.ProtoMinor = test.major, test.minor
+		a := NewAssetHandler("./assets/").WithMaxAge(time.Hour)
+		if test.http1Only {
+			a = a.WithExpiresForHTTP1Only()
+		}
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Cache-Control"), "public, max-age=3600", i)
+		isEqual(t, w.Header().Get("Expires") != "", test.expires, i)
+	}
+}
+
+func TestServeHTTPWithOriginalLastModified(t *testing.T) {
+	original := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	compressed := time.Date(2024, 6, 7, 8, 9, 10, 0, time.UTC)
+
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/js/app.js", []byte("function app() {}\n"), 0644)
+	afero.WriteFile(mfs, "/js/app.js.gz", []byte("not really gzipped"), 0644)
+	must(mfs.Chtimes("/js/app.js", original, original))
+	must(mfs.Chtimes("/js/app.js.gz", compressed, compressed))
+
+	cases := []struct {
+		fromOriginal    bool
+		encoding        string
+		lastModified    time.Time
+		ifModifiedSince time.Time
+		code            int
+	}{
+		{fromOriginal: false, encoding: "gzip", lastModified: compressed, code: 200},
+		{fromOriginal: true, encoding: "gzip", lastModified: original, code: 200},
+		{fromOriginal: false, encoding: "xx", lastModified: original, code: 200},
+		{fromOriginal: true, encoding: "xx", lastModified: original, code: 200},
+		{fromOriginal: false, encoding: "gzip", ifModifiedSince: original, code: 200},
+		{fromOriginal: true, encoding: "gzip", ifModifiedSince: original, code: 304},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", "/js/app.js", nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		if !test.ifModifiedSince.IsZero() {
+			request.Header.Set("If-Modified-Since", test.ifModifiedSince.Format(http.TimeFormat))
+		}
+		a := NewAssetHandlerFS(mfs)
+		if test.fromOriginal {
+			a = a.WithOriginalLastModified()
+		}
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		if !test.lastModified.IsZero() {
+			isEqual(t, w.Header().Get("Last-Modified"), test.lastModified.Format(http.TimeFormat), i)
+		}
+	}
+}
+
+func TestServeHTTPWithMinCompressionRatio(t *testing.T) {
+	cases := []struct {
+		ratio    float64
+		url      string
+		encoding string
+		conEnc   string
+		size     int
+	}{
+		// style1.css.br is no smaller than style1.css and style1.css.gz is larger
+		{ratio: 0, url: "/css/style1.css", encoding: "br", conEnc: "br", size: 31},
+		{ratio: 0.15, url: "/css/style1.css", encoding: "br", conEnc: "", size: 31},
+		{ratio: 0.15, url: "/css/style1.css", encoding: "br, gzip", conEnc: "", size: 31},
+		{ratio: 0, url: "/css/style1.css", encoding: "gzip", conEnc: "gzip", size: 60},
+		{ratio: 0.15, url: "/css/style1.css", encoding: "gzip", conEnc: "", size: 31},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		a := NewAssetHandler("./assets/").WithMinCompressionRatio(test.ratio)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Content-Encoding"), test.conEnc, i)
+		isEqual(t, w.Body.Len(), test.size, i)
+	}
+}
+
+func TestCompressionWorthwhile(t *testing.T) {
+	cases := []struct {
+		ratio                    float64
+		originalSize, compressed int64
+		expected                 bool
+	}{
+		{ratio: 0.15, originalSize: 100, compressed: 85, expected: true},
+		{ratio: 0.15, originalSize: 100, compressed: 86, expected: false},
+		{ratio: 0.15, originalSize: 0, compressed: 86, expected: true},
+		{ratio: 0.5, originalSize: 1000, compressed: 100, expected: true},
+	}
+
+	for i, test := range cases {
+		a := NewAssetHandler("./assets/").WithMinCompressionRatio(test.ratio)
+		isEqual(t, a.compressionWorthwhile(test.originalSize, test.compressed), test.expected, i)
+	}
+}
+
+func TestServeHTTPWithContentTypes(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/app.wasm", []byte("\x00asm"), 0644)
+	afero.WriteFile(mfs, "/app.wasm.gz", []byte("gzipped"), 0644)
+	afero.WriteFile(mfs, "/app.wasm.br", []byte("brotli"), 0644)
+	afero.WriteFile(mfs, "/data.foo", []byte("foo"), 0644)
+	afero.WriteFile(mfs, "/data.foo.gz", []byte("gzipped"), 0644)
+
+	cases := []struct {
+		path, encoding string
+		conEnc         string
+		conType        string
+	}{
+		{path: "/app.wasm", encoding: "gzip", conEnc: "gzip", conType: "application/wasm"},
+		{path: "/app.wasm", encoding: "br", conEnc: "br", conType: "application/wasm"},
+		{path: "/app.wasm", encoding: "xx", conEnc: "", conType: "application/wasm"},
+		{path: "/data.foo", encoding: "gzip", conEnc: "gzip", conType: "application/x-foo"},
+		{path: "/data.foo", encoding: "xx", conEnc: "", conType: "application/x-foo"},
+	}
+
+	a := NewAssetHandlerFS(mfs).WithContentTypes(map[string]string{".wasm": "application/wasm", "FOO": "application/x-foo"})
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.path, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Content-Encoding"), test.conEnc, i)
+		isEqual(t, w.Header().Get("Content-Type"), test.conType, i)
+	}
+}
+
+func TestServeHTTPIgnoresExpectContinue(t *testing.T) {
+	server := httptest.NewServer(NewAssetHandler("./assets/"))
+	defer server.Close()
+
+	for i, method := range []string{"GET", "HEAD"} {
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		must(err)
+		must(conn.SetDeadline(time.Now().Add(2 * time.Second)))
+
+		// a raw request is needed because the Go client never sends Expect without a body
+		fmt.Fprintf(conn, "%s /css/style2.css HTTP/1.1\r\nHost: example.com\r\nExpect: 100-continue\r\nConnection: close\r\n\r\n", method)
+		start := time.Now()
+		response, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: method})
+		must(err)
+		body, err := io.ReadAll(response.Body)
+		must(err)
+		conn.Close()
+
+		// there is no interim 100-continue response and no stalling
+		isEqual(t, response.StatusCode, http.StatusOK, i)
+		isEqual(t, response.Header.Get("Content-Length"), "34", i)
+		isEqual(t, time.Since(start) < time.Second, true, i)
+		if method == "GET" {
+			isEqual(t, len(body), 34, i)
+		}
+	}
+}
+
+func TestServeHTTPWithAuthorize(t *testing.T) {
+	authorize := func(req *http.Request) bool {
+		c, err := req.Cookie("session")
+		return err == nil && c.Value == "valid"
+	}
+	login := http.RedirectHandler("/login", http.StatusFound)
+
+	cases := []struct {
+		method, path, session string
+		unauthorized          http.Handler
+		code                  int
+		body                  string
+	}{
+		{method: "GET", path: "/css/style2.css", session: "valid", code: 200},
+		{method: "GET", path: "/css/style2.css", session: "", code: 401, body: "401 Unauthorized\n"},
+		{method: "GET", path: "/css/style2.css", session: "forged", code: 401, body: "401 Unauthorized\n"},
+		{method: "HEAD", path: "/css/style2.css", session: "", code: 401},
+		{method: "GET", path: "/css/style2.css", session: "", unauthorized: login, code: 302},
+		{method: "GET", path: "/healthz", session: "", code: 200},
+	}
+
+	for i, test := range cases {
+		cfs := &countingFS{fs: os.DirFS("assets")}
+		a := NewAssetHandlerIoFS(cfs).WithHealthPath("/healthz").WithAuthorize(authorize, test.unauthorized)
+
+		request, _ := http.NewRequest(test.method, test.path, nil)
+		if test.session != "" {
+			request.AddCookie(&http.Cookie{Name: "session", Value: test.session})
+		}
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		if test.body != "" {
+			isEqual(t, w.Body.String(), test.body, i)
+		}
+		if test.code != 200 {
+			isEqual(t, cfs.count.Load(), int32(0), i)
+		}
+	}
+}
+
+func TestServeHTTPWithExtensionRewrite(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/about.htm", []byte("<html>about</html>"), 0644)
+	afero.WriteFile(mfs, "/about.htm.gz", []byte("gzipped"), 0644)
+	afero.WriteFile(mfs, "/data.txt", []byte(`{"a":1}`), 0644)
+
+	cases := []struct {
+		path, encoding string
+		code           int
+		conEnc         string
+		conType        string
+		body           string
+	}{
+		{path: "/about.html", encoding: "xx", code: 200, conType: "text/html; charset=utf-8", body: "<html>about</html>"},
+		{path: "/about.html", encoding: "gzip", code: 200, conEnc: "gzip", conType: "text/html; charset=utf-8", body: "gzipped"},
+		{path: "/about.htm", encoding: "xx", code: 200, conType: "text/html; charset=utf-8", body: "<html>about</html>"},
+		{path: "/data.json", encoding: "xx", code: 200, conType: "application/json", body: `{"a":1}`},
+		{path: "/missing.html", encoding: "xx", code: 404},
+	}
+
+	a := NewAssetHandlerFS(mfs).WithExtensionRewrite(map[string]string{".html": ".htm", "JSON": "txt"})
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.path, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		if test.code == 200 {
+			isEqual(t, w.Header().Get("Content-Encoding"), test.conEnc, i)
+			isEqual(t, w.Header().Get("Content-Type"), test.conType, i)
+			isEqual(t, w.Body.String(), test.body, i)
+		}
+	}
+}
+
+func TestServeHTTPWithVaryCookie(t *testing.T) {
+	cases := []struct {
+		a            *Assets
+		encoding     string
+		cacheControl string
+		vary         string
+	}{
+		{a: NewAssetHandler("./assets/").WithMaxAge(time.Hour).WithVaryCookie(), encoding: "gzip", cacheControl: "private, max-age=3600", vary: "Accept-Encoding, Cookie"},
+		{a: NewAssetHandler("./assets/").WithMaxAge(time.Hour).WithVaryCookie(), encoding: "xx", cacheControl: "private, max-age=3600", vary: "Cookie"},
+		{a: NewAssetHandler("./assets/").WithVaryCookie(), encoding: "xx", cacheControl: "private", vary: "Cookie"},
+		{a: NewAssetHandler("./assets/").WithVaryCookie().WithDefaultMaxAge(time.Minute), encoding: "xx", cacheControl: "private, max-age=60", vary: "Cookie"},
+		{a: NewAssetHandler("./assets/").WithMaxAge(time.Hour), encoding: "xx", cacheControl: "public, max-age=3600", vary: ""},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		w := httptest.NewRecorder()
+
+		test.a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Cache-Control"), test.cacheControl, i)
+		isEqual(t, w.Header().Get("Vary"), test.vary, i)
+	}
+}
+
+func TestServeHTTPWithExtraVary(t *testing.T) {
+	cases := []struct {
+		url, encoding string
+		code          int
+		vary          []string
+	}{
+		{url: "/css/style1.css", encoding: "gzip", code: 200, vary: []string{"Accept-Encoding, X-Tenant, Accept-Language"}},
+		{url: "/css/style1.css", encoding: "xx", code: 200, vary: []string{"X-Tenant, Accept-Encoding, Accept-Language"}},
+		{url: "/img/nonexisting.png", encoding: "gzip", code: 404, vary: nil},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		a := NewAssetHandler("./assets/").WithExtraVary("x-tenant", "Accept-Encoding").WithExtraVary("Accept-Language")
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Values("Vary"), test.vary, i)
+	}
+}
+
+func TestServeHTTPNeverServesUnacceptedEncoding(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/gz-only.js", []byte("function gzOnly() {}\n"), 0644)
+	afero.WriteFile(mfs, "/gz-only.js.gz", []byte("gzipped"), 0644)
+	afero.WriteFile(mfs, "/br-only.js", []byte("function brOnly() {}\n"), 0644)
+	afero.WriteFile(mfs, "/br-only.js.br", []byte("brotli"), 0644)
+
+	cases := []struct {
+		path, encoding, conEnc, body string
+	}{
+		{path: "/gz-only.js", encoding: "br", conEnc: "", body: "function gzOnly() {}\n"},
+		{path: "/gz-only.js", encoding: "gzip", conEnc: "gzip", body: "gzipped"},
+		{path: "/gz-only.js", encoding: "br, gzip", conEnc: "gzip", body: "gzipped"},
+		{path: "/gz-only.js", encoding: "br, gzip;q=0", conEnc: "", body: "function gzOnly() {}\n"},
+		{path: "/gz-only.js", encoding: "identity", conEnc: "", body: "function gzOnly() {}\n"},
+		{path: "/br-only.js", encoding: "gzip", conEnc: "", body: "function brOnly() {}\n"},
+		{path: "/br-only.js", encoding: "br", conEnc: "br", body: "brotli"},
+		{path: "/br-only.js", encoding: "gzip, br", conEnc: "br", body: "brotli"},
+		{path: "/br-only.js", encoding: "", conEnc: "", body: "function brOnly() {}\n"},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.path, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		a := NewAssetHandlerFS(mfs)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Content-Encoding"), test.conEnc, i)
+		isEqual(t, w.Body.String(), test.body, i)
+	}
+}
+
+func TestServeHTTPIgnoresCompressedVariantDirectory(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/css/style.css", []byte("body {}\n"), 0644)
+	afero.WriteFile(mfs, "/css/style.css.gz/index.html", []byte("<html>misplaced</html>"), 0644)
+	afero.WriteFile(mfs, "/css/style.css.br/x.txt", []byte("x"), 0644)
+	afero.WriteFile(mfs, "/css/other.css", []byte("p {}\n"), 0644)
+	afero.WriteFile(mfs, "/css/other.css.gz", []byte("gzipped"), 0644)
+	afero.WriteFile(mfs, "/css/other.css.br/x.txt", []byte("x"), 0644)
+
+	cases := []struct {
+		path, encoding, conEnc, body string
+	}{
+		{path: "/css/style.css", encoding: "br, gzip", conEnc: "", body: "body {}\n"},
+		{path: "/css/style.css", encoding: "gzip", conEnc: "", body: "body {}\n"},
+		{path: "/css/style.css", encoding: "br", conEnc: "", body: "body {}\n"},
+		{path: "/css/other.css", encoding: "br, gzip", conEnc: "gzip", body: "gzipped"},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.path, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		a := NewAssetHandlerFS(mfs)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Content-Encoding"), test.conEnc, i)
+		isEqual(t, w.Header().Get("Content-Type"), "text/css; charset=utf-8", i)
+		isEqual(t, w.Body.String(), test.body, i)
+	}
+
+	list, err := NewAssetHandlerFS(mfs).List()
+	isEqual(t, err, nil, "list")
+	isEqual(t, list, []string{"/css/other.css", "/css/style.css"}, "list")
+}
+
+func TestServeHTTPWithNoTransform(t *testing.T) {
+	cases := []struct {
+		a            *Assets
+		encoding     string
+		cacheControl string
+	}{
+		{a: NewAssetHandler("./assets/").WithMaxAge(time.Hour).WithNoTransform(), encoding: "gzip", cacheControl: "public, max-age=3600, no-transform"},
+		{a: NewAssetHandler("./assets/").WithMaxAge(time.Hour).WithNoTransform(), encoding: "br", cacheControl: "public, max-age=3600, no-transform"},
+		{a: NewAssetHandler("./assets/").WithMaxAge(time.Hour).WithNoTransform(), encoding: "xx", cacheControl: "public, max-age=3600"},
+		{a: NewAssetHandler("./assets/").WithNoTransform(), encoding: "gzip", cacheControl: "no-transform"},
+		{a: NewAssetHandler("./assets/").WithMaxAge(time.Hour), encoding: "gzip", cacheControl: "public, max-age=3600"},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		w := httptest.NewRecorder()
+
+		test.a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Cache-Control"), test.cacheControl, i)
+	}
+}
+
+func TestServeHTTPWithNetworkAwareCompression(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/app.js", []byte("function app() {}\n"), 0644)
+	afero.WriteFile(mfs, "/app.js.gz", []byte("smallest"), 0644)
+	afero.WriteFile(mfs, "/app.js.br", []byte("not the smallest"), 0644)
+	afero.WriteFile(mfs, "/lib.js", []byte("function lib() {}\n"), 0644)
+	afero.WriteFile(mfs, "/lib.js.br", []byte("brotli"), 0644)
+
+	// on this site, gzip happens to give the smallest files
+	a := NewAssetHandlerFS(mfs).WithNetworkAwareCompression(func(req *http.Request) string {
+		if req.Header.Get("ECT") == "slow-2g" {
+			return "gzip"
+		}
+		return ""
+	})
+
+	cases := []struct {
+		path, ect, encoding, conEnc, body string
+	}{
+		{path: "/app.js", ect: "slow-2g", encoding: "br, gzip", conEnc: "gzip", body: "smallest"},
+		{path: "/app.js", ect: "4g", encoding: "br, gzip", conEnc: "br", body: "not the smallest"},
+		{path: "/app.js", ect: "", encoding: "br, gzip", conEnc: "br", body: "not the smallest"},
+		{path: "/app.js", ect: "slow-2g", encoding: "br", conEnc: "br", body: "not the smallest"},
+		{path: "/lib.js", ect: "slow-2g", encoding: "br, gzip", conEnc: "br", body: "brotli"},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.path, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		if test.ect != "" {
+			request.Header.Set("ECT", test.ect)
+		}
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Content-Encoding"), test.conEnc, i)
+		isEqual(t, w.Body.String(), test.body, i)
+	}
+}
+
+func TestServeHTTPWithCanonicalEncodingVary(t *testing.T) {
+	cases := []struct {
+		encoding, conEnc, bucket string
+	}{
+		{encoding: "gzip, deflate, br", conEnc: "br", bucket: "br"},
+		{encoding: "br, gzip", conEnc: "br", bucket: "br"},
+		{encoding: "gzip, deflate", conEnc: "gzip", bucket: "gzip"},
+		{encoding: "deflate", conEnc: "", bucket: "identity"},
+		{encoding: "", conEnc: "", bucket: "identity"},
+	}
+
+	a := NewAssetHandler("./assets/").WithCanonicalEncodingVary()
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Content-Encoding"), test.conEnc, i)
+		isEqual(t, w.Header().Get("X-Encoding-Bucket"), test.bucket, i)
+	}
+
+	request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	NewAssetHandler("./assets/").ServeHTTP(w, request)
+	isEqual(t, w.Header().Get("X-Encoding-Bucket"), "", "default")
+}
+
+func TestServeHTTPWithEnabledEncodings(t *testing.T) {
+	cases := []struct {
+		encodings []string
+		url       string
+		conEnc    string
+		accesses  int32
+	}{
+		{encodings: nil, url: "/css/style1.css", conEnc: "br", accesses: 1},
+		{encodings: nil, url: "/css/style2.css", conEnc: "", accesses: 3},
+		{encodings: []string{"br"}, url: "/css/style2.css", conEnc: "", accesses: 2},
+		{encodings: []string{"gzip"}, url: "/css/style1.css", conEnc: "gzip", accesses: 1},
+		{encodings: []string{}, url: "/css/style1.css", conEnc: "", accesses: 1},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		request.Header.Set("Accept-Encoding", "br, gzip")
+		cfs := &countingFS{fs: os.DirFS("assets")}
+		a := NewAssetHandlerIoFS(cfs)
+		if test.encodings != nil {
+			a = a.WithEnabledEncodings(test.encodings...)
+		}
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Content-Encoding"), test.conEnc, i)
+		// stats only; opening the chosen file is not counted
+		isEqual(t, cfs.count.Load()-cfs.opens.Load(), test.accesses, i)
+	}
+}
+
+func BenchmarkWithEnabledEncodings(b *testing.B) {
+	cfs := &countingFS{fs: os.DirFS("assets")}
+	all := NewAssetHandlerIoFS(cfs)
+	brOnly := all.WithEnabledEncodings("br")
+
+	for name, a := range map[string]*Assets{"all": all, "br": brOnly} {
+		b.Run(name, func(b *testing.B) {
+			cfs.count.Store(0)
+			cfs.opens.Store(0)
+			for i := 0; i < b.N; i++ {
+				request, _ := http.NewRequest("GET", "/css/style2.css", nil)
+				request.Header.Set("Accept-Encoding", "br, gzip")
+				a.ServeHTTP(httptest.NewRecorder(), request)
+			}
+			b.ReportMetric(float64(cfs.count.Load()-cfs.opens.Load())/float64(b.N), "stats/op")
+		})
+	}
+}
+
+//-------------------------------------------------------------------------------------------------
+
+type h4xx struct{ code int }
+
+func (h *h4xx) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(w.Header()) > 0 {
+		panic(fmt.Sprintf("still holding headers %+v", w.Header()))
+	}
+	w.Header().Set(ContentType, "text/html")
+	w.WriteHeader(h.code)
+	if r.Method != http.MethodHead {
+		w.Write([]byte("<html>foo</html>"))
+	}
+}
+
+func Test405Handling(t *testing.T) {
+	cases := []struct {
+		method, path      string
+		conType, response string
+		conLen, allow     string
+		notAllowed        http.Handler
+	}{
+		{method: "POST", path: "/img/nonexisting.png", conType: "text/html", response: "<html>foo</html>", notAllowed: &h4xx{code: 405}},
+		{method: "POST", path: "/img/nonexisting.png", conType: "text/plain; charset=utf-8", response: "405 Method Not Allowed\n", conLen: "23", allow: "GET, HEAD, OPTIONS"},
+		{method: "PUT", path: "/img/nonexisting.png", conType: "text/plain; charset=utf-8", response: "405 Method Not Allowed\n", conLen: "23", allow: "GET, HEAD, OPTIONS"},
+		{method: "DELETE", path: "/img/nonexisting.png", conType: "text/plain; charset=utf-8", response: "405 Method Not Allowed\n", conLen: "23", allow: "GET, HEAD, OPTIONS"},
+	}
+
+	for i, test := range cases {
+		url := mustUrl("" + test.path)
+		request := &http.Request{Method: test.method, URL: url}
+		a := NewAssetHandler("./assets/").WithMethodNotAllowed(test.notAllowed)
+		isEqual(t, a.MethodNotAllowed, test.notAllowed, i)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusMethodNotAllowed, i)
+		isEqual(t, w.Header().Get("Allow"), test.allow, i)
+		isEqual(t, w.Header().Get("Content-Type"), test.conType, i)
+		isEqual(t, w.Header().Get("Content-Length"), test.conLen, i)
+		isEqual(t, w.Body.String(), test.response, i)
+	}
+}
+
+func TestTraceAndConnectAreRejected(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a careless handler that reflects the request
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.Copy(w, r.Body)
+	})
+
+	cases := []struct {
+		method           string
+		methodNotAllowed http.Handler
+	}{
+		{method: "TRACE"},
+		{method: "TRACE", methodNotAllowed: echo},
+		{method: "CONNECT"},
+		{method: "CONNECT", methodNotAllowed: echo},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest(test.method, "/css/style1.css", strings.NewReader("Cookie: secret"))
+		request.Header.Set("Cookie", "secret")
+		a := NewAssetHandler("./assets/").WithMethodNotAllowed(test.methodNotAllowed)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusMethodNotAllowed, i)
+		isEqual(t, w.Header().Get("Allow"), "GET, HEAD, OPTIONS", i)
+		isEqual(t, w.Body.String(), "405 Method Not Allowed\n", i)
+		isEqual(t, strings.Contains(w.Body.String(), "secret"), false, i)
+	}
+}
+
+func TestOptionsHandling(t *testing.T) {
+	cases := []struct {
+		path             string
+		methodNotAllowed http.Handler
+	}{
+		{path: "/css/style1.css"},
+		{path: "/img/nonexisting.png"},
+		{path: "*"},
+		{path: "/css/style1.css", methodNotAllowed: &h4xx{code: 405}},
+	}
+
+	for i, test := range cases {
+		request := &http.Request{Method: "OPTIONS", URL: &URL{Path: test.path}, Header: newHeader()}
+		a := NewAssetHandler("./assets/").WithMethodNotAllowed(test.methodNotAllowed)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusNoContent, i)
+		isEqual(t, w.Header().Get("Allow"), "GET, HEAD, OPTIONS", i)
+		isEqual(t, w.Body.Len(), 0, i)
+	}
+}
+
+func TestHeadIsNeverPassedToMethodNotAllowed(t *testing.T) {
+	cases := []struct {
+		path string
+		code int
+	}{
+		{path: "/css/style1.css", code: http.StatusOK},
+		{path: "/img/nonexisting.png", code: http.StatusNotFound},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("HEAD", test.path, nil)
+		a := NewAssetHandler("./assets/").WithMethodNotAllowed(&h4xx{code: 405})
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Allow"), "", i)
+		isEqual(t, w.Body.Len(), 0, i)
+	}
+}
+
+func Test404Handling(t *testing.T) {
+	cases := []struct {
+		method, path      string
+		conType, response string
+		conLen            string
+		notFound          http.Handler
+	}{
+		{method: "GET", path: "/img/nonexisting.png", conType: "text/html", response: "<html>foo</html>", notFound: &h4xx{code: 404}},
+		{method: "GET", path: "/img/nonexisting.png", conType: "text/plain; charset=utf-8", response: "404 Not found\n", conLen: "14"},
+		{method: "HEAD", path: "/img/nonexisting.png", conType: "", response: ""},
+	}
+
+	for i, test := range cases {
+		url := mustUrl("" + test.path)
+		request := &http.Request{Method: test.method, URL: url}
+		a := NewAssetHandler("./assets/").WithNotFound(test.notFound)
+		isEqual(t, a.NotFound, test.notFound, i)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusNotFound, i)
+		isEqual(t, w.Header().Get("Content-Type"), test.conType, i)
+		isEqual(t, w.Header().Get("Content-Length"), test.conLen, i)
+		isEqual(t, w.Body.String(), test.response, i)
+	}
+}
+
+func TestAutoHeadForHandlers(t *testing.T) {
+	bodyWriter := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(ContentType, "text/html")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<html>foo</html>"))
+	})
+
+	cases := []struct {
+		method string
+		body   string
+	}{
+		{method: "HEAD", body: ""},
+		{method: "GET", body: "<html>foo</html>"},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest(test.method, "/img/nonexisting.png", nil)
+		a := NewAssetHandler("./assets/").WithNotFound(bodyWriter).WithAutoHeadForHandlers()
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusNotFound, i)
+		isEqual(t, w.Header().Get("Content-Type"), "text/html", i)
+		isEqual(t, w.Body.String(), test.body, i)
+	}
+}
+
+func TestNoContentForEmptyHead(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/alive.txt", nil, 0644)
+	afero.WriteFile(mfs, "/app.txt", []byte("hello"), 0644)
+
+	cases := []struct {
+		option        bool
+		method, path  string
+		code          int
+		contentLength string
+	}{
+		{option: true, method: "HEAD", path: "/alive.txt", code: 204, contentLength: ""},
+		{option: false, method: "HEAD", path: "/alive.txt", code: 200, contentLength: "0"},
+		{option: true, method: "GET", path: "/alive.txt", code: 200, contentLength: "0"},
+		{option: true, method: "HEAD", path: "/app.txt", code: 200, contentLength: "5"},
+		{option: true, method: "HEAD", path: "/missing.txt", code: 404, contentLength: ""},
+	}
+
+	for i, test := range cases {
+		a := NewAssetHandlerFS(mfs)
+		if test.option {
+			a = a.WithNoContentForEmptyHead()
+		}
+		request, _ := http.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Content-Length"), test.contentLength, i)
+		isEqual(t, w.Body.Len(), 0, i)
+	}
+}
+
+func TestResolvedPathHeader(t *testing.T) {
+	cases := []struct {
+		url, encoding string
+		code          int
+		resolved      string
+	}{
+		{url: "/v1/css/style1.css", encoding: "xx", code: 200, resolved: "/css/style1.css"},
+		{url: "/v1/css/style1.css", encoding: "gzip", code: 200, resolved: "/css/style1.css.gz"},
+		{url: "/v1/", encoding: "xx", code: 200, resolved: "/index.html"},
+		{url: "/v1/css/", encoding: "xx", code: 200, resolved: "/css/"},
+		{url: "/v1/css/nonexisting.css", encoding: "xx", code: 404, resolved: ""},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		a := NewAssetHandler("./assets/").StripOff(1).WithResolvedPathHeader()
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("X-Resolved-Path"), test.resolved, i)
+	}
+
+	// strictly opt-in
+	request, _ := http.NewRequest("GET", "/v1/css/style1.css", nil)
+	w := httptest.NewRecorder()
+	NewAssetHandler("./assets/").StripOff(1).ServeHTTP(w, request)
+	isEqual(t, w.Header().Get("X-Resolved-Path"), "", "default")
+}
+
+func TestSlowServeLog(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/js/app.js", []byte("function app() {}\n"), 0644)
+
+	cases := []struct {
+		delay  time.Duration
+		logged bool
+	}{
+		{delay: 20 * time.Millisecond, logged: true},
+		{delay: 0, logged: false},
+	}
+
+	defer func(original Printer) { Debugf = original }(Debugf)
+
+	for i, test := range cases {
+		var logged []string
+		Debugf = func(format string, v ...interface{}) {
+			if strings.Contains(format, "(slow)") {
+				logged = append(logged, fmt.Sprintf(format, v...))
+			}
+		}
+
+		request, _ := http.NewRequest("GET", "/js/app.js", nil)
+		a := NewAssetHandlerFS(slowFs{Fs: mfs, delay: test.delay}).WithSlowServeLog(10 * time.Millisecond)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, len(logged) == 1, test.logged, i)
+		if test.logged {
+			isEqual(t, strings.Contains(logged[0], "GET /js/app.js took "), true, i)
+		}
+	}
+}
+
+func TestCustomErrorText(t *testing.T) {
+	a := NewAssetHandler("./assets/").WithNotFoundText("Nothing to see here")
+	b := NewAssetHandlerFS(&fs403{os.ErrPermission}).WithForbiddenText("Keep out")
+	c := NewAssetHandlerFS(&fs403{os.ErrInvalid}).WithServiceUnavailableText("Try later")
+
+	cases := []struct {
+		a        *Assets
+		code     int
+		response string
+	}{
+		{a: a, code: http.StatusNotFound, response: "Nothing to see here\n"},
+		{a: b, code: http.StatusForbidden, response: "Keep out\n"},
+		{a: c, code: http.StatusServiceUnavailable, response: "Try later\n"},
+		{a: NewAssetHandler("./assets/"), code: http.StatusNotFound, response: "404 Not found\n"},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", "/img/nonexisting.png", nil)
+		w := httptest.NewRecorder()
+
+		test.a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Content-Type"), "text/plain; charset=utf-8", i)
+		isEqual(t, w.Header().Get("Content-Length"), fmt.Sprintf("%d", len(test.response)), i)
+		isEqual(t, w.Body.String(), test.response, i)
+	}
+}
+
+func Test400Handling(t *testing.T) {
+	cases := []struct {
+		method, path string
+		response     string
+	}{
+		{method: "GET", path: "/img/sort\x01asc.png", response: "400 Bad request\n"},
+		{method: "GET", path: "/css/\nstyle1.css", response: "400 Bad request\n"},
+		{method: "GET", path: "/css/style1.css\x1f", response: "400 Bad request\n"},
+		{method: "HEAD", path: "/css/\tstyle1.css", response: ""},
+	}
+
+	for i, test := range cases {
+		request := &http.Request{Method: test.method, URL: &URL{Path: test.path}}
+		a := NewAssetHandlerFS(&fs403{os.ErrInvalid}) // any filesystem access would give 503
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusBadRequest, i)
+		isEqual(t, w.Body.String(), test.response, i)
+	}
+}
+
+func Test421Handling(t *testing.T) {
+	cases := []struct {
+		host string
+		code int
+	}{
+		{host: "example.com", code: http.StatusOK},
+		{host: "Example.COM:8080", code: http.StatusOK},
+		{host: "cdn.example.org", code: http.StatusOK},
+		{host: "other.example.com", code: http.StatusMisdirectedRequest},
+		{host: "", code: http.StatusMisdirectedRequest},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+		request.Host = test.host
+		a := NewAssetHandler("./assets/").WithAllowedHosts([]string{"example.com", "cdn.example.org"})
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		if test.code != http.StatusOK {
+			isEqual(t, w.Body.String(), "421 Misdirected Request\n", i)
+		}
+	}
+}
+
+func Test451Handling(t *testing.T) {
+	cases := []struct {
+		method, path string
+		code         int
+		link         string
+		body         string
+	}{
+		{method: "GET", path: "/img/sort_asc.png", code: 451, link: `<https://authority.example.org/>; rel="blocked-by"`, body: "451 Unavailable For Legal Reasons\n"},
+		{method: "HEAD", path: "/img/sort_asc.png", code: 451, link: `<https://authority.example.org/>; rel="blocked-by"`, body: ""},
+		{method: "GET", path: "/css/style1.css", code: 451, link: "", body: "451 Unavailable For Legal Reasons\n"},
+		{method: "GET", path: "/css/style2.css", code: 200, link: ""},
+		// the block cannot be bypassed
+		{method: "GET", path: "/css/style1.css.raw", code: 451, link: "", body: "451 Unavailable For Legal Reasons\n"},
+		{method: "GET", path: "/x", code: 451, link: "", body: "451 Unavailable For Legal Reasons\n"},
+		{method: "GET", path: "/css/style1.css.gz", code: 451, link: "", body: "451 Unavailable For Legal Reasons\n"},
+		{method: "GET", path: "/css/style1.css.br", code: 451, link: "", body: "451 Unavailable For Legal Reasons\n"},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest(test.method, test.path, nil)
+		request.Header.Set("Accept-Encoding", "br, gzip")
+		a := NewAssetHandler("./assets/").WithLegalBlock(map[string]string{
+			"/img/sort_asc.png": "https://authority.example.org/",
+			"css/style1.css":    "",
+		}).WithIdentitySuffix(".raw").WithAliasMap(map[string]string{"/x": "css/style1.css"})
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Link"), test.link, i)
+		if test.code != 200 {
+			isEqual(t, w.Body.String(), test.body, i)
+		}
+	}
+}
+
+func Test403Handling(t *testing.T) {
+	cases := []struct {
+		path   string
+		header http.Header
+	}{
+		{path: "/css/style1.css", header: newHeader()},
+		{path: "/css/style1.css", header: newHeader("Accept-Encoding", "gzip")},
+	}
+
+	for i, test := range cases {
+		url := mustUrl("" + test.path)
+		request := &http.Request{Method: "GET", URL: url, Header: test.header}
+		a := NewAssetHandlerFS(&fs403{os.ErrPermission})
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusForbidden, i)
+		isEqual(t, w.Header().Get("Content-Type"), "text/plain; charset=utf-8", i)
+		isEqual(t, w.Header().Get("Content-Length"), "14", i)
+		isEqual(t, w.Body.String(), "403 Forbidden\n", i)
 	}
 }
 
-func TestServeHTTP200WithGzipButNoAcceptHeader(t *testing.T) {
+func TestServeHTTPNestedIndexWithoutRedirect(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/docs/index.html", []byte("<html>docs</html>"), 0644)
+	afero.WriteFile(mfs, "/docs/api/v1/index.html", []byte("<html>v1</html>"), 0644)
+
 	cases := []struct {
-		n                                       int
-		maxAge                                  time.Duration
-		url, mime, encoding, path, cacheControl string
+		method, path string
+		code         int
+		body         string
 	}{
-		{0, 1, "/css/style1.css", cssMimeType, "xx, yy, zzz", "assets/css/style1.css", "public, max-age=1"},
-		{2, 2, "/a/b/css/style1.css", cssMimeType, "xx, yy, zzz", "assets/css/style1.css", "public, max-age=2"},
-		{0, 3, "/js/script1.js", javascriptMimeType, "xx, yy, zzz", "assets/js/script1.js", "public, max-age=3"},
-		{2, 4, "/a/b/js/script1.js", javascriptMimeType, "xx, yy, zzz", "assets/js/script1.js", "public, max-age=4"},
+		{method: "GET", path: "/docs/", code: 200, body: "<html>docs</html>"},
+		{method: "GET", path: "/docs/api/v1/", code: 200, body: "<html>v1</html>"},
+		{method: "HEAD", path: "/docs/api/v1/", code: 200, body: ""},
+		{method: "GET", path: "/x/docs/api/v1/", code: 200, body: "<html>v1</html>"},
 	}
 
-	for _, test := range cases {
-		etag := etagFor(test.path)
-		url := mustUrl(test.url)
-		header := newHeader("Accept-Encoding", test.encoding)
-		request := &http.Request{Method: "GET", URL: url, Header: header}
-		a := NewAssetHandler("./assets/").StripOff(test.n).WithMaxAge(test.maxAge * time.Second)
+	for i, test := range cases {
+		request, _ := http.NewRequest(test.method, test.path, nil)
+		a := NewAssetHandlerFS(mfs)
+		if strings.HasPrefix(test.path, "/x/") {
+			a = a.StripOff(1)
+		}
 		w := httptest.NewRecorder()
 
 		a.ServeHTTP(w, request)
 
-		isEqual(t, w.Code, http.StatusOK, test.path)
-		headers := w.Header()
-		//t.Logf("%+v\n", headers)
-		isGte(t, len(headers), 6, test.path)
-		isEqual(t, headers["Cache-Control"], []string{test.cacheControl}, test.path)
-		isEqual(t, headers["Content-Type"], []string{test.mime}, test.path)
-		isEqual(t, headers["Content-Encoding"], emptyStrings, test.path)
-		isEqual(t, headers["Vary"], emptyStrings, test.path)
-		isEqual(t, headers["Etag"], []string{etag}, test.path)
-		isEqual(t, len(headers["Expires"]), 1, test.path)
-		isGte(t, len(headers["Expires"][0]), 25, test.path)
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Location"), "", i)
+		isEqual(t, w.Header().Get("Content-Type"), "text/html; charset=utf-8", i)
+		isNotEqual(t, w.Header().Get("ETag"), "", i)
+		isEqual(t, w.Body.String(), test.body, i)
 	}
 }
 
-func TestServeHTTP200WithGzipAcceptHeaderButNoGzippedFile(t *testing.T) {
+func TestServeHTTPNestedIndexWithCompression(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/docs/index.html", []byte("<html>docs</html>"), 0644)
+	afero.WriteFile(mfs, "/docs/index.html.gz", []byte("gzipped index"), 0644)
+	afero.WriteFile(mfs, "/docs/index.html.br", []byte("brotli index"), 0644)
+
 	cases := []struct {
-		n                                       int
-		maxAge                                  time.Duration
-		url, mime, encoding, path, cacheControl string
+		path, encoding, conEnc, body string
 	}{
-		{0, 1, "/css/style2.css", cssMimeType, "xx, gzip, zzz", "assets/css/style2.css", "public, max-age=1"},
-		{0, 1, "/css/style2.css", cssMimeType, "br, gzip, zzz", "assets/css/style2.css", "public, max-age=1"},
-		{2, 2, "/a/b/css/style2.css", cssMimeType, "xx, gzip, zzz", "assets/css/style2.css", "public, max-age=2"},
-		{2, 2, "/a/b/css/style2.css", cssMimeType, "br, gzip, zzz", "assets/css/style2.css", "public, max-age=2"},
-		{0, 3, "/js/script2.js", javascriptMimeType, "xx, gzip, zzz", "assets/js/script2.js", "public, max-age=3"},
-		{0, 3, "/js/script2.js", javascriptMimeType, "br, gzip, zzz", "assets/js/script2.js", "public, max-age=3"},
-		{2, 4, "/a/b/js/script2.js", javascriptMimeType, "xx, gzip, zzz", "assets/js/script2.js", "public, max-age=4"},
-		{2, 4, "/a/b/js/script2.js", javascriptMimeType, "br, gzip, zzz", "assets/js/script2.js", "public, max-age=4"},
-		{0, 5, "/img/sort_asc.png", "image/png", "xx, gzip, zzz", "assets/img/sort_asc.png", "public, max-age=5"},
-		{0, 5, "/img/sort_asc.png", "image/png", "br, gzip, zzz", "assets/img/sort_asc.png", "public, max-age=5"},
-		{2, 6, "/a/b/img/sort_asc.png", "image/png", "xx, gzip, zzz", "assets/img/sort_asc.png", "public, max-age=6"},
-		{2, 6, "/a/b/img/sort_asc.png", "image/png", "br, gzip, zzz", "assets/img/sort_asc.png", "public, max-age=6"},
+		{path: "/docs/", encoding: "br", conEnc: "br", body: "brotli index"},
+		{path: "/docs/", encoding: "gzip", conEnc: "gzip", body: "gzipped index"},
+		{path: "/docs/", encoding: "br, gzip", conEnc: "br", body: "brotli index"},
+		{path: "/docs/", encoding: "xx", conEnc: "", body: "<html>docs</html>"},
+		{path: "/x/docs/", encoding: "br", conEnc: "br", body: "brotli index"},
 	}
 
-	for _, test := range cases {
-		etag := etagFor(test.path)
-		url := mustUrl(test.url)
-		header := newHeader("Accept-Encoding", test.encoding)
-		request := &http.Request{Method: "GET", URL: url, Header: header}
-		a := NewAssetHandler("./assets/").StripOff(test.n).WithMaxAge(test.maxAge * time.Second)
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.path, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		a := NewAssetHandlerFS(mfs)
+		if strings.HasPrefix(test.path, "/x/") {
+			a = a.StripOff(1)
+		}
 		w := httptest.NewRecorder()
 
 		a.ServeHTTP(w, request)
 
-		isEqual(t, w.Code, http.StatusOK, test.path)
-		headers := w.Header()
-		//t.Logf("%+v\n", headers)
-		isGte(t, len(headers), 6, test.path)
-		isEqual(t, headers["Cache-Control"], []string{test.cacheControl}, test.path)
-		isEqual(t, headers["Content-Type"], []string{test.mime}, test.path)
-		isEqual(t, headers["Content-Encoding"], emptyStrings, test.path)
-		isEqual(t, headers["Vary"], emptyStrings, test.path)
-		isEqual(t, headers["Etag"], []string{etag}, test.path)
-		isEqual(t, len(headers["Expires"]), 1, test.path)
-		isGte(t, len(headers["Expires"][0]), 25, test.path)
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Location"), "", i)
+		isEqual(t, w.Header().Get("Content-Type"), "text/html; charset=utf-8", i)
+		isEqual(t, w.Header().Get("Content-Encoding"), test.conEnc, i)
+		if test.conEnc != "" {
+			isEqual(t, w.Header().Get("Vary"), "Accept-Encoding", i)
+		}
+		isEqual(t, w.Header().Get("Content-Length"), fmt.Sprint(len(test.body)), i)
+		isEqual(t, strings.HasPrefix(w.Header().Get("ETag"), `W/"`), test.conEnc != "", i)
+		isEqual(t, w.Body.String(), test.body, i)
 	}
 }
 
-//-------------------------------------------------------------------------------------------------
-
-type h4xx struct{ code int }
+func TestServeHTTPWithoutStdlibRedirects(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/docs/index.html", []byte("<html>docs</html>"), 0644)
+	afero.WriteFile(mfs, "/docs/a.txt", []byte("a"), 0644)
 
-func (h *h4xx) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if len(w.Header()) > 0 {
-		panic(fmt.Sprintf("still holding headers %+v", w.Header()))
+	cases := []struct {
+		without  bool
+		method   string
+		path     string
+		code     int
+		location string
+		body     string
+	}{
+		{without: false, method: "GET", path: "/v1/docs/index.html", code: 301, location: "./"},
+		{without: true, method: "GET", path: "/v1/docs/index.html", code: 200, body: "<html>docs</html>"},
+		{without: true, method: "HEAD", path: "/v1/docs/index.html", code: 200},
+		{without: true, method: "GET", path: "/v1/docs/", code: 200, body: "<html>docs</html>"},
+		{without: true, method: "GET", path: "/v1/docs/a.txt", code: 200, body: "a"},
 	}
-	w.Header().Set(ContentType, "text/html")
-	w.WriteHeader(h.code)
-	if r.Method != http.MethodHead {
-		w.Write([]byte("<html>foo</html>"))
+
+	for i, test := range cases {
+		request, _ := http.NewRequest(test.method, test.path, nil)
+		a := NewAssetHandlerFS(mfs).StripOff(1)
+		if test.without {
+			a = a.WithoutStdlibRedirects()
+		}
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Location"), test.location, i)
+		if test.body != "" {
+			isEqual(t, w.Body.String(), test.body, i)
+		}
 	}
 }
 
-func Test405Handling(t *testing.T) {
+func TestNoRedirectWriter(t *testing.T) {
 	cases := []struct {
-		method, path      string
-		conType, response string
-		notAllowed        http.Handler
+		code, expected int
 	}{
-		{method: "POST", path: "/img/nonexisting.png", conType: "text/html", response: "<html>foo</html>", notAllowed: &h4xx{code: 405}},
-		{method: "POST", path: "/img/nonexisting.png", conType: "text/plain; charset=utf-8", response: "405 Method Not Allowed\n"},
-		{method: "PUT", path: "/img/nonexisting.png", conType: "text/plain; charset=utf-8", response: "405 Method Not Allowed\n"},
-		{method: "DELETE", path: "/img/nonexisting.png", conType: "text/plain; charset=utf-8", response: "405 Method Not Allowed\n"},
+		{code: 301, expected: 404},
+		{code: 302, expected: 404},
+		{code: 304, expected: 304},
+		{code: 200, expected: 200},
 	}
 
 	for i, test := range cases {
-		url := mustUrl("" + test.path)
-		request := &http.Request{Method: test.method, URL: url}
-		a := NewAssetHandler("./assets/").WithMethodNotAllowed(test.notAllowed)
-		isEqual(t, a.MethodNotAllowed, test.notAllowed, i)
 		w := httptest.NewRecorder()
+		nw := &noRedirectWriter{ResponseWriter: w, a: NewAssetHandler("./assets/"), method: "GET"}
 
-		a.ServeHTTP(w, request)
+		nw.Header().Set("Location", "/internal/path/")
+		nw.WriteHeader(test.code)
+		nw.Write([]byte("x"))
 
-		isEqual(t, w.Code, http.StatusMethodNotAllowed, i)
-		isEqual(t, w.Header().Get("Content-Type"), test.conType, i)
-		isEqual(t, w.Body.String(), test.response, i)
+		isEqual(t, w.Code, test.expected, i)
+		if test.expected == 404 {
+			isEqual(t, w.Header().Get("Location"), "", i)
+			isEqual(t, w.Body.String(), "404 Not found\n", i)
+		}
 	}
 }
 
-func Test404Handling(t *testing.T) {
+func TestServeHTTPWithIndexRedirect(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/docs/index.html", []byte("<html>docs</html>"), 0644)
+	afero.WriteFile(mfs, "/docs/api/index.html.gz", []byte("gzipped"), 0644)
+	afero.WriteFile(mfs, "/files/a.txt", []byte("a"), 0644)
+
 	cases := []struct {
-		method, path      string
-		conType, response string
-		notFound          http.Handler
+		redirect bool
+		strip    int
+		path     string
+		code     int
+		location string
+		body     string
 	}{
-		{method: "GET", path: "/img/nonexisting.png", conType: "text/html", response: "<html>foo</html>", notFound: &h4xx{code: 404}},
-		{method: "GET", path: "/img/nonexisting.png", conType: "text/plain; charset=utf-8", response: "404 Not found\n"},
+		{redirect: true, path: "/docs", code: 301, location: "/docs/"},
+		{redirect: true, path: "/docs?x=1", code: 301, location: "/docs/?x=1"},
+		{redirect: true, path: "/docs/api", code: 301, location: "/docs/api/"},
+		{redirect: true, strip: 1, path: "/v1/docs", code: 301, location: "/v1/docs/"},
+		{redirect: true, path: "/docs/", code: 200, body: "<html>docs</html>"},
+		{redirect: true, path: "/files", code: 200}, // no index, so listed in place
+		{redirect: false, path: "/docs", code: 200, body: "<html>docs</html>"},
+		{redirect: false, strip: 1, path: "/v1/docs", code: 200, body: "<html>docs</html>"},
 	}
 
 	for i, test := range cases {
-		url := mustUrl("" + test.path)
-		request := &http.Request{Method: test.method, URL: url}
-		a := NewAssetHandler("./assets/").WithNotFound(test.notFound)
-		isEqual(t, a.NotFound, test.notFound, i)
+		request, _ := http.NewRequest("GET", test.path, nil)
+		a := NewAssetHandlerFS(mfs).StripOff(test.strip)
+		if test.redirect {
+			a = a.WithIndexRedirect()
+		}
 		w := httptest.NewRecorder()
 
 		a.ServeHTTP(w, request)
 
-		isEqual(t, w.Code, http.StatusNotFound, i)
-		isEqual(t, w.Header().Get("Content-Type"), test.conType, i)
-		isEqual(t, w.Body.String(), test.response, i)
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Location"), test.location, i)
+		if test.body != "" {
+			isEqual(t, w.Body.String(), test.body, i)
+		}
 	}
 }
 
-func Test403Handling(t *testing.T) {
+func TestForbiddenIndexIsNotListed(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/dir/index.html", []byte("<html></html>"), 0644)
+	afero.WriteFile(mfs, "/dir/secret.txt", []byte("secret"), 0644)
+
 	cases := []struct {
-		path   string
-		header http.Header
+		path           string
+		disableListing bool
 	}{
-		{path: "/css/style1.css", header: newHeader()},
-		{path: "/css/style1.css", header: newHeader("Accept-Encoding", "gzip")},
+		{path: "/dir/", disableListing: false},
+		{path: "/dir/", disableListing: true},
 	}
 
 	for i, test := range cases {
-		url := mustUrl("" + test.path)
-		request := &http.Request{Method: "GET", URL: url, Header: test.header}
-		a := NewAssetHandlerFS(&fs403{os.ErrPermission})
+		request, _ := http.NewRequest("GET", test.path, nil)
+		a := NewAssetHandlerFS(forbiddenFileFs{Fs: mfs, forbidden: "dir/index.html"}).WithMaxAge(time.Hour)
+		a.DisableDirListing = test.disableListing
 		w := httptest.NewRecorder()
 
 		a.ServeHTTP(w, request)
 
 		isEqual(t, w.Code, http.StatusForbidden, i)
-		isEqual(t, w.Header().Get("Content-Type"), "text/plain; charset=utf-8", i)
 		isEqual(t, w.Body.String(), "403 Forbidden\n", i)
+		isEqual(t, w.Header().Get("Cache-Control"), "", i)
 	}
 }
 
@@ -476,10 +2182,195 @@ func Test503Handling(t *testing.T) {
 		isEqual(t, w.Code, http.StatusServiceUnavailable, i)
 		isEqual(t, w.Header().Get("Content-Type"), "text/plain; charset=utf-8", i)
 		isNotEqual(t, w.Header().Get("Retry-After"), "", i)
+		isEqual(t, w.Header().Get("Content-Length"), "24", i)
 		isEqual(t, w.Body.String(), "503 Service unavailable\n", i)
 	}
 }
 
+// saturatingFS behaves like a server that has run out of file descriptors once saturated is set.
+type saturatingFS struct {
+	fs.FS
+	saturated bool
+}
+
+func (s *saturatingFS) Open(name string) (fs.File, error) {
+	if s.saturated {
+		return nil, os.ErrInvalid
+	}
+	return s.FS.Open(name)
+}
+
+func Test503HandlingWithServiceUnavailableFile(t *testing.T) {
+	const page = "<html><body>Back soon</body></html>"
+
+	cases := []struct {
+		file, method, contentType, body string
+	}{
+		{file: "/503.html", method: "GET", contentType: "text/html; charset=utf-8", body: page},
+		{file: "503.html", method: "GET", contentType: "text/html; charset=utf-8", body: page},
+		{file: "/503.html", method: "HEAD", contentType: "", body: ""},
+	}
+
+	for i, test := range cases {
+		sfs := &saturatingFS{FS: fstest.MapFS{
+			"503.html":       {Data: []byte(page)},
+			"css/style1.css": {Data: []byte("body {}\n")},
+		}}
+		a := NewAssetHandlerIoFS(sfs).WithServiceUnavailableFile(test.file)
+		sfs.saturated = true
+
+		request, _ := http.NewRequest(test.method, "/css/style1.css", nil)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusServiceUnavailable, i)
+		isEqual(t, w.Header().Get("Content-Type"), test.contentType, i)
+		isNotEqual(t, w.Header().Get("Retry-After"), "", i)
+		isEqual(t, w.Body.String(), test.body, i)
+	}
+}
+
+func TestWithServiceUnavailableFileMissing(t *testing.T) {
+	defer func() {
+		isNotEqual(t, recover(), nil, 0)
+	}()
+
+	NewAssetHandler("./assets/").WithServiceUnavailableFile("/missing.html")
+	t.Errorf("expected a panic")
+}
+
+// appearingFS hides each file until it has been looked for a certain number of times, as if it
+// were being renamed into place.
+type appearingFS struct {
+	fs.FS
+	hidden  int
+	lookups map[string]int
+}
+
+func (a *appearingFS) Open(name string) (fs.File, error) {
+	a.lookups[name]++
+	if a.lookups[name] <= a.hidden {
+		return nil, fs.ErrNotExist
+	}
+	return a.FS.Open(name)
+}
+
+func TestServeHTTPWithNotFoundRetry(t *testing.T) {
+	cases := []struct {
+		path            string
+		hidden, retries int
+		code            int
+		lookups         int
+	}{
+		{path: "/app.js", hidden: 1, retries: 1, code: 200},
+		{path: "/app.js", hidden: 1, retries: 3, code: 200},
+		{path: "/app.js", hidden: 2, retries: 1, code: 404, lookups: 2},
+		{path: "/app.js", hidden: 1, retries: 0, code: 404, lookups: 1},
+		{path: "/missing.js", hidden: 0, retries: 2, code: 404, lookups: 3},
+	}
+
+	for i, test := range cases {
+		afs := &appearingFS{
+			FS:      fstest.MapFS{"app.js": {Data: []byte("function app() {}\n")}},
+			hidden:  test.hidden,
+			lookups: make(map[string]int),
+		}
+		a := NewAssetHandlerIoFS(afs).WithNotFoundRetry(test.retries, time.Millisecond)
+
+		request, _ := http.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		if test.code == 200 {
+			isEqual(t, w.Body.String(), "function app() {}\n", i)
+		} else {
+			isEqual(t, afs.lookups[removeLeadingSlash(test.path)], test.lookups, i)
+		}
+	}
+}
+
+//-------------------------------------------------------------------------------------------------
+
+func mustZipReader(dir string) *zip.Reader {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	must(zw.AddFS(os.DirFS(dir)))
+	must(zw.Close())
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	must(err)
+	return zr
+}
+
+func TestServeHTTPFromZip(t *testing.T) {
+	cases := []struct {
+		method, url, encoding string
+		code                  int
+		conType, conEnc       string
+		body                  int
+	}{
+		{method: "GET", url: "/css/style1.css", encoding: "gzip", code: 200, conType: cssMimeType, conEnc: "gzip", body: 60},
+		{method: "GET", url: "/css/style1.css", encoding: "xx", code: 200, conType: cssMimeType, body: 31},
+		{method: "HEAD", url: "/css/style1.css", encoding: "xx", code: 200, conType: cssMimeType, body: 0},
+		{method: "GET", url: "/", encoding: "xx", code: 200, conType: "text/html; charset=utf-8", body: 36},
+		{method: "GET", url: "/css/", encoding: "xx", code: 200, conType: "text/html; charset=utf-8", body: 237},
+		{method: "GET", url: "/img/nonexisting.png", encoding: "xx", code: 404, conType: "text/plain; charset=utf-8", body: 14},
+	}
+
+	a := NewAssetHandlerIoFS(mustZipReader("assets")).WithMaxAge(time.Hour)
+
+	for i, test := range cases {
+		for j := 0; j < 2; j++ {
+			request, _ := http.NewRequest(test.method, test.url, nil)
+			request.Header.Set("Accept-Encoding", test.encoding)
+			w := httptest.NewRecorder()
+
+			a.ServeHTTP(w, request)
+
+			isEqual(t, w.Code, test.code, i)
+			isEqual(t, w.Header().Get("Content-Type"), test.conType, i)
+			isEqual(t, w.Header().Get("Content-Encoding"), test.conEnc, i)
+			isEqual(t, w.Body.Len(), test.body, i)
+		}
+	}
+}
+
+func TestServeHTTPRootListingWithoutIndex(t *testing.T) {
+	a := NewAssetHandlerIoFS(mustZipReader("assets/css"))
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, request)
+
+	isEqual(t, w.Code, http.StatusOK, 0)
+	isEqual(t, strings.Contains(w.Body.String(), "style1.css"), true, 0)
+}
+
+func TestServeHTTPFromZipHasStableEtag(t *testing.T) {
+	a := NewAssetHandlerIoFS(mustZipReader("assets"))
+	b := NewAssetHandlerIoFS(mustZipReader("assets"))
+
+	r1, _ := http.NewRequest("GET", "/js/script2.js", nil)
+	w1 := httptest.NewRecorder()
+	a.ServeHTTP(w1, r1)
+
+	r2, _ := http.NewRequest("GET", "/js/script2.js", nil)
+	w2 := httptest.NewRecorder()
+	b.ServeHTTP(w2, r2)
+
+	isNotEqual(t, w1.Header().Get("Etag"), "", 0)
+	isEqual(t, w1.Header().Get("Etag"), w2.Header().Get("Etag"), 0)
+
+	r3, _ := http.NewRequest("GET", "/js/script2.js", nil)
+	r3.Header.Set("If-None-Match", w1.Header().Get("Etag"))
+	w3 := httptest.NewRecorder()
+	b.ServeHTTP(w3, r3)
+
+	isEqual(t, w3.Code, http.StatusNotModified, 0)
+}
+
 //-------------------------------------------------------------------------------------------------
 
 func TestServeHTTP304(t *testing.T) {
@@ -539,6 +2430,42 @@ func TestServeHTTP304(t *testing.T) {
 	}
 }
 
+func TestServeHTTPWithWeakETagsOnly(t *testing.T) {
+	cases := []struct {
+		url, path, encoding string
+	}{
+		{url: "/css/style1.css", path: "assets/css/style1.css.gz", encoding: "gzip"},
+		{url: "/css/style1.css", path: "assets/css/style1.css.br", encoding: "br"},
+		{url: "/css/style2.css", path: "assets/css/style2.css", encoding: "xx"},
+		{url: "/img/sort_asc.png", path: "assets/img/sort_asc.png", encoding: "xx"},
+		{url: "/", path: "assets/index.html", encoding: "xx"},
+	}
+
+	for i, test := range cases {
+		etag := "W/" + etagFor(test.path)
+		a := NewAssetHandler("./assets/").WithWeakETagsOnly()
+
+		request, _ := http.NewRequest("GET", test.url, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Etag"), etag, i)
+
+		request, _ = http.NewRequest("GET", test.url, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		request.Header.Set("If-None-Match", etag)
+		w = httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusNotModified, i)
+		isEqual(t, w.Header().Get("Etag"), etag, i)
+	}
+}
+
 //-------------------------------------------------------------------------------------------------
 
 func Benchmark(t *testing.B) {
@@ -683,6 +2610,42 @@ func etagFor(name string) string {
 
 //-------------------------------------------------------------------------------------------------
 
+// forbiddenFileFs denies access to one file only.
+type forbiddenFileFs struct {
+	afero.Fs
+	forbidden string
+}
+
+func (fs forbiddenFileFs) Open(name string) (afero.File, error) {
+	if removeLeadingSlash(name) == fs.forbidden {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+	}
+	return fs.Fs.Open(name)
+}
+
+func (fs forbiddenFileFs) Stat(name string) (os.FileInfo, error) {
+	if removeLeadingSlash(name) == fs.forbidden {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrPermission}
+	}
+	return fs.Fs.Stat(name)
+}
+
+// slowFs delays every file access.
+type slowFs struct {
+	afero.Fs
+	delay time.Duration
+}
+
+func (fs slowFs) Open(name string) (afero.File, error) {
+	time.Sleep(fs.delay)
+	return fs.Fs.Open(name)
+}
+
+func (fs slowFs) Stat(name string) (os.FileInfo, error) {
+	time.Sleep(fs.delay)
+	return fs.Fs.Stat(name)
+}
+
 type fs403 struct {
 	err error
 }
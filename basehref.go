@@ -0,0 +1,124 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// WithBaseHrefInjection alters the handler so that every HTML document it serves contains
+// <base href="..."> with the specified href, e.g. "/app/" when a single-page application is
+// mounted under that sub-path. Any existing base tag is replaced; otherwise the tag is inserted at
+// the start of the head element.
+//
+// The whole document is read into memory and altered for every request, so this is only suitable
+// for small HTML files. Precompressed variants of HTML files are not used, byte-range requests for
+// them are served in full, and their ETags are weak because the representation is derived from
+// the file. The ETags also depend on the href.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithBaseHrefInjection(href string) *Assets {
+	a.baseHref = href
+	return &a
+}
+
+var (
+	baseTag = regexp.MustCompile(`(?i)<base(\s[^>]*)?>`)
+	headTag = regexp.MustCompile(`(?i)<head(\s[^>]*)?>`)
+	htmlTag = regexp.MustCompile(`(?i)<html(\s[^>]*)?>`)
+)
+
+// altersHTML decides whether an asset is an HTML document that is altered before it is served,
+// either by WithBaseHrefInjection or WithCSPNonce.
+func (a *Assets) altersHTML(name string) bool {
+	return (a.baseHref != "" || a.cspNonce) && a.isHTML(name)
+}
+
+// injectBaseHref replaces or inserts the base tag in an HTML document.
+func (a *Assets) injectBaseHref(doc []byte) []byte {
+	tag := []byte(`<base href="` + html.EscapeString(a.baseHref) + `">`)
+
+	if loc := baseTag.FindIndex(doc); loc != nil {
+		return concat(doc[:loc[0]], tag, doc[loc[1]:])
+	}
+
+	for _, re := range []*regexp.Regexp{headTag, htmlTag} {
+		if loc := re.FindIndex(doc); loc != nil {
+			return concat(doc[:loc[1]], tag, doc[loc[1]:])
+		}
+	}
+
+	return concat(tag, doc)
+}
+
+// alteredEtag derives the ETag of an altered document from that of its file, so that it changes
+// when the injected base href changes, e.g. after redeploying under another sub-path.
+func (a *Assets) alteredEtag(etag string) string {
+	if a.baseHref == "" {
+		return etag
+	}
+
+	h := sha256.New()
+	io.WriteString(h, etag+"\n"+a.baseHref)
+	return fmt.Sprintf(`"%x"`, h.Sum(nil)[:16])
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// serveAlteredHTML serves an HTML document after injecting the base href and the nonce, if
+// any, into it.
+func (a *Assets) serveAlteredHTML(w http.ResponseWriter, req *http.Request, resource string, modTime time.Time, nonce string) {
+	doc, modTime, err := a.readResource(resource, modTime)
+	if err != nil {
+		Debugf("Assets serve file %s %v\n", resource, err)
+		a.httpError(w, ServiceUnavailable, req.Method)
+		return
+	}
+
+	if a.baseHref != "" {
+		doc = a.injectBaseHref(doc)
+	}
+
+	if nonce != "" {
+		doc = injectNonce(doc, nonce)
+		// the document differs every time so it has no validators
+		modTime = time.Time{}
+	}
+
+	if req.Header.Get(Range) != "" {
+		// byte ranges are meaningless because the document differs from the file
+		req = req.Clone(req.Context())
+		req.Header.Del(Range)
+	}
+
+	http.ServeContent(w, req, resource, modTime, bytes.NewReader(doc))
+}
@@ -0,0 +1,86 @@
+package servefiles
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rickb777/servefiles/v3/afero2"
+	"github.com/spf13/afero"
+)
+
+func TestBaseHrefInjection(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/index.html", []byte("<html><head><title>x</title></head><body>index</body></html>"), 0644)
+	afero.WriteFile(mfs, "/index.html.gz", []byte("gzipped"), 0644)
+	afero.WriteFile(mfs, "/based.html", []byte(`<html><HEAD><base href="/"></HEAD></html>`), 0644)
+	afero.WriteFile(mfs, "/bare.html", []byte("<p>hello</p>"), 0644)
+	afero.WriteFile(mfs, "/app.js", []byte("<head>"), 0644)
+
+	cases := []struct {
+		path, encoding, rng string
+		body                string
+	}{
+		{path: "/", encoding: "gzip", body: `<html><head><base href="/app/"><title>x</title></head><body>index</body></html>`},
+		{path: "/index.html", encoding: "xx", rng: "bytes=0-3", body: `<html><head><base href="/app/"><title>x</title></head><body>index</body></html>`},
+		{path: "/based.html", encoding: "xx", body: `<html><HEAD><base href="/app/"></HEAD></html>`},
+		{path: "/bare.html", encoding: "xx", body: `<base href="/app/"><p>hello</p>`},
+		{path: "/app.js", encoding: "xx", body: "<head>"},
+	}
+
+	a := NewAssetHandlerFS(mfs).WithBaseHrefInjection("/app/")
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.path, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		if test.rng != "" {
+			request.Header.Set("Range", test.rng)
+		}
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Content-Encoding"), "", i)
+		isEqual(t, w.Body.String(), test.body, i)
+		isEqual(t, w.Header().Get("Content-Length"), strconv.Itoa(len(test.body)), i)
+		if strings.HasSuffix(test.path, ".js") {
+			isEqual(t, strings.HasPrefix(w.Header().Get("ETag"), `"`), true, i)
+		} else {
+			isEqual(t, strings.HasPrefix(w.Header().Get("ETag"), `W/"`), true, i)
+			isEqual(t, w.Header().Get("Accept-Ranges"), "none", i)
+		}
+	}
+}
+
+func TestBaseHrefInjectionTestdata(t *testing.T) {
+	a := NewAssetHandler("./assets/").WithBaseHrefInjection(`/a"b/`)
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	a.ServeHTTP(w, request)
+
+	isEqual(t, w.Code, http.StatusOK, 0)
+	isEqual(t, w.Header().Get("Content-Type"), "text/html; charset=utf-8", 0)
+	isEqual(t, w.Body.String(), `<html><base href="/a&#34;b/"><body>index page</body></html>`, 0)
+}
+
+func TestBaseHrefInjectionETagDependsOnHref(t *testing.T) {
+	etag := func(a *Assets) string {
+		request, _ := http.NewRequest("GET", "/", nil)
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, request)
+		isEqual(t, w.Code, http.StatusOK, a.baseHref)
+		return w.Header().Get("ETag")
+	}
+
+	a := NewAssetHandler("./assets/")
+	app := etag(a.WithBaseHrefInjection("/app/"))
+
+	isNotEqual(t, app, "W/"+etag(a), "plain")
+	isNotEqual(t, app, etag(a.WithBaseHrefInjection("/other/")), "other")
+	isEqual(t, app, etag(a.WithBaseHrefInjection("/app/")), "same")
+}
@@ -0,0 +1,141 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/rickb777/path"
+)
+
+// WithCanonicalHost alters the handler so that requests for any other scheme or host receive a
+// 301-moved permanently redirect to the same path on the canonical scheme and host, e.g.
+// "http://www.example.com/app.js" is redirected to "https://example.com/app.js". The host may
+// include a port. If the scheme is blank, only the host is checked.
+//
+// Behind a reverse proxy, the scheme and host seen by the server may differ from those used by
+// the client; see WithTrustedForwardedHeaders.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithCanonicalHost(scheme, host string) *Assets {
+	a.canonicalScheme = strings.ToLower(scheme)
+	a.canonicalHost = strings.ToLower(host)
+	return &a
+}
+
+// WithTrustedForwardedHeaders alters the handler so that the "X-Forwarded-Proto" and
+// "X-Forwarded-Host" request headers are used to determine the scheme and host for
+// WithCanonicalHost. Only use this when the server is behind a proxy that sets these headers,
+// because otherwise clients can choose their values.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithTrustedForwardedHeaders() *Assets {
+	a.trustForwarded = true
+	return &a
+}
+
+// canonicalTarget determines whether the request needs to be redirected to the canonical host,
+// and if so, the URL to redirect to.
+func (a *Assets) canonicalTarget(req *http.Request) (string, bool) {
+	if a.canonicalHost == "" {
+		return "", false
+	}
+
+	scheme, host := requestSchemeAndHost(req, a.trustForwarded)
+
+	if strings.EqualFold(host, a.canonicalHost) && (a.canonicalScheme == "" || scheme == a.canonicalScheme) {
+		return "", false
+	}
+
+	if a.canonicalScheme != "" {
+		scheme = a.canonicalScheme
+	}
+
+	target := scheme + "://" + a.canonicalHost + req.URL.EscapedPath()
+	if req.URL.RawQuery != "" {
+		target += "?" + req.URL.RawQuery
+	}
+	return target, true
+}
+
+// WithCanonicalLowercasePaths alters the handler so that a request for an asset path containing
+// uppercase letters receives a 301-moved permanently redirect to the all-lowercase path, e.g.
+// "/CSS/Style.css" is redirected to "/css/style.css". So each asset has a single cache key, even
+// on case-insensitive filesystems. The redirect only happens when the lowercase asset exists, so
+// this is also safe on case-sensitive filesystems. Any unwanted prefix segments are not altered.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithCanonicalLowercasePaths() *Assets {
+	a.lowercasePaths = true
+	return &a
+}
+
+// lowercaseTarget determines whether the request needs to be redirected to the lowercase path,
+// and if so, the path to redirect to.
+func (a *Assets) lowercaseTarget(req *http.Request, logical string) (string, bool) {
+	if !a.lowercasePaths {
+		return "", false
+	}
+
+	lower := strings.ToLower(logical)
+	if lower == logical {
+		return "", false
+	}
+
+	if fd := a.checkResource(removeTrailingSlash(lower), make(http.Header)); fd.code != OK && fd.code != Directory {
+		return "", false
+	}
+
+	head, _ := path.Divide(req.URL.Path, a.UnwantedPrefixSegments)
+	target := head + lower
+	if req.URL.RawQuery != "" {
+		target += "?" + req.URL.RawQuery
+	}
+	return target, true
+}
+
+func requestSchemeAndHost(req *http.Request, trustForwarded bool) (string, string) {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	host := req.Host
+
+	if trustForwarded {
+		// a chain of proxies gives a comma-separated list; the first is nearest to the client
+		if proto := firstListItem(req.Header.Get(XForwardedProto)); proto != "" {
+			scheme = strings.ToLower(proto)
+		}
+		if fwdHost := firstListItem(req.Header.Get(XForwardedHost)); fwdHost != "" {
+			host = fwdHost
+		}
+	}
+
+	return scheme, host
+}
+
+func firstListItem(value string) string {
+	first, _, _ := strings.Cut(value, ",")
+	return strings.TrimSpace(first)
+}
@@ -0,0 +1,107 @@
+package servefiles
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServeHTTPWithCanonicalHost(t *testing.T) {
+	cases := []struct {
+		url            string
+		tls            bool
+		trust          bool
+		proto, fwdHost string
+		code           int
+		location       string
+	}{
+		{url: "http://www.example.com/js/script1.js?v=1", code: 301, location: "https://example.com/js/script1.js?v=1"},
+		{url: "http://example.com/js/script1.js", code: 301, location: "https://example.com/js/script1.js"},
+		{url: "https://www.example.com/js/script1.js", tls: true, code: 301, location: "https://example.com/js/script1.js"},
+		{url: "https://example.com/js/script1.js", tls: true, code: 200},
+		{url: "https://EXAMPLE.com/js/script1.js", tls: true, code: 200},
+
+		// forwarded headers are ignored unless trusted
+		{url: "http://internal:8080/js/script1.js", proto: "https", fwdHost: "example.com", code: 301, location: "https://example.com/js/script1.js"},
+		{url: "http://internal:8080/js/script1.js", trust: true, proto: "https", fwdHost: "example.com", code: 200},
+		{url: "http://internal:8080/js/script1.js", trust: true, proto: "https, http", fwdHost: "example.com, internal", code: 200},
+		{url: "http://internal:8080/js/script1.js", trust: true, proto: "http", fwdHost: "example.com", code: 301, location: "https://example.com/js/script1.js"},
+		{url: "http://internal:8080/js/script1.js", trust: true, proto: "https", fwdHost: "www.example.com", code: 301, location: "https://example.com/js/script1.js"},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		if test.tls {
+			request.TLS = &tls.ConnectionState{}
+		}
+		if test.proto != "" {
+			request.Header.Set("X-Forwarded-Proto", test.proto)
+		}
+		if test.fwdHost != "" {
+			request.Header.Set("X-Forwarded-Host", test.fwdHost)
+		}
+		a := NewAssetHandler("./assets/").WithCanonicalHost("https", "example.com")
+		if test.trust {
+			a = a.WithTrustedForwardedHeaders()
+		}
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Location"), test.location, i)
+	}
+}
+
+func TestServeHTTPWithCanonicalHostOnly(t *testing.T) {
+	cases := []struct {
+		url      string
+		code     int
+		location string
+	}{
+		{url: "http://www.example.com/js/script1.js", code: 301, location: "http://example.com/js/script1.js"},
+		{url: "http://example.com/js/script1.js", code: 200},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		a := NewAssetHandler("./assets/").WithCanonicalHost("", "example.com")
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Location"), test.location, i)
+	}
+}
+
+func TestServeHTTPWithCanonicalLowercasePaths(t *testing.T) {
+	cases := []struct {
+		url      string
+		prefix   int
+		code     int
+		location string
+	}{
+		{url: "/CSS/Style1.css", code: 301, location: "/css/style1.css"},
+		{url: "/js/Script1.js?v=1", code: 301, location: "/js/script1.js?v=1"},
+		{url: "/IMG/", code: 301, location: "/img/"},
+		{url: "/V1/CSS/Style1.css", prefix: 1, code: 301, location: "/V1/css/style1.css"},
+		{url: "/css/style1.css", code: 200},
+		{url: "/V1/css/style1.css", prefix: 1, code: 200},
+
+		// the lowercase target doesn't exist
+		{url: "/css/Missing.css", code: 404},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		a := NewAssetHandler("./assets/").StripOff(test.prefix).WithCanonicalLowercasePaths()
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Location"), test.location, i)
+	}
+}
@@ -0,0 +1,90 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"sync"
+	"time"
+)
+
+// WithCircuitBreaker alters the handler so that, after threshold consecutive requests that failed
+// because the server seems saturated, e.g. because it has run out of file descriptors, every
+// request receives a 503-service unavailable response without any filesystem access until the
+// cooldown has passed. This avoids hammering a struggling backend, such as a network filesystem.
+// These responses have a Retry-After header giving the remaining cooldown. Each request counts
+// once, however many files were tried for it. Failures older than the cooldown are forgotten and
+// any request served without such an error resets the count. The state is shared by the handler
+// and its copies.
+// Health checks (see WithHealthPath) are never affected. This method panics if threshold is less
+// than one or cooldown is not positive.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithCircuitBreaker(threshold int, cooldown time.Duration) *Assets {
+	if threshold < 1 {
+		panic("Circuit breaker threshold must be at least one")
+	}
+	if cooldown <= 0 {
+		panic("Circuit breaker cooldown must be positive")
+	}
+	a.breaker = &circuitBreaker{threshold: threshold, cooldown: cooldown}
+	return &a
+}
+
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  []time.Time // within the last cooldown period, oldest first
+	openUntil time.Time
+}
+
+// open returns true while the breaker is tripped, with the remaining cooldown.
+func (b *circuitBreaker) open() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wait := time.Until(b.openUntil)
+	return wait, wait > 0
+}
+
+// record counts the outcome of a request, tripping the breaker when the threshold is reached.
+func (b *circuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		b.failures = b.failures[:0]
+		return
+	}
+
+	now := time.Now()
+	for len(b.failures) > 0 && now.Sub(b.failures[0]) > b.cooldown {
+		b.failures = b.failures[1:]
+	}
+
+	b.failures = append(b.failures, now)
+	if len(b.failures) >= b.threshold {
+		b.failures = nil
+		b.openUntil = now.Add(b.cooldown)
+	}
+}
@@ -0,0 +1,120 @@
+package servefiles
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	sfs := &saturatingFS{FS: fstest.MapFS{
+		"css/style1.css": {Data: []byte("body {}\n")},
+	}}
+	cfs := &countingFS{fs: sfs}
+	a := NewAssetHandlerIoFS(cfs).WithHealthPath("/healthz").WithCircuitBreaker(2, 100*time.Millisecond)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, request)
+		return w
+	}
+
+	sfs.saturated = true
+
+	// the errors reach the threshold
+	for i := 0; i < 2; i++ {
+		w := serve("/css/style1.css")
+		isEqual(t, w.Code, http.StatusServiceUnavailable, i)
+		isNotEqual(t, w.Header().Get("Retry-After"), "", i)
+	}
+
+	// the breaker is open, even though the filesystem has recovered
+	sfs.saturated = false
+	cfs.count.Store(0)
+
+	w := serve("/css/style1.css")
+	isEqual(t, w.Code, http.StatusServiceUnavailable, "open")
+	isEqual(t, w.Header().Get("Retry-After"), "1", "open")
+	isEqual(t, w.Body.String(), "503 Service unavailable\n", "open")
+	isEqual(t, cfs.count.Load(), int32(0), "filesystem access")
+
+	isEqual(t, serve("/healthz").Code, http.StatusOK, "health")
+
+	// after the cooldown, requests are served again
+	time.Sleep(120 * time.Millisecond)
+
+	w = serve("/css/style1.css")
+	isEqual(t, w.Code, http.StatusOK, "closed")
+	isEqual(t, w.Body.String(), "body {}\n", "closed")
+}
+
+func TestCircuitBreakerNeedsConsecutiveErrors(t *testing.T) {
+	sfs := &saturatingFS{FS: fstest.MapFS{
+		"css/style1.css": {Data: []byte("body {}\n")},
+	}}
+	a := NewAssetHandlerIoFS(sfs).WithCircuitBreaker(2, time.Minute)
+
+	for i, saturated := range []bool{true, false, true, false} {
+		sfs.saturated = saturated
+		request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		if saturated {
+			isEqual(t, w.Code, http.StatusServiceUnavailable, i)
+		} else {
+			isEqual(t, w.Code, http.StatusOK, i)
+		}
+	}
+}
+
+func TestCircuitBreakerCountsEachRequestOnce(t *testing.T) {
+	sfs := &saturatingFS{FS: fstest.MapFS{
+		"css/style1.css":    {Data: []byte("body {}\n")},
+		"css/style1.css.br": {Data: []byte("br")},
+		"css/style1.css.gz": {Data: []byte("gz")},
+	}}
+	a := NewAssetHandlerIoFS(sfs).WithCircuitBreaker(2, time.Minute)
+
+	// one request tries several variants but is still only one failure
+	sfs.saturated = true
+	request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+	request.Header.Set("Accept-Encoding", "br, gzip")
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, request)
+	isEqual(t, w.Code, http.StatusServiceUnavailable, "saturated")
+
+	sfs.saturated = false
+	request, _ = http.NewRequest("GET", "/css/style1.css", nil)
+	w = httptest.NewRecorder()
+	a.ServeHTTP(w, request)
+	isEqual(t, w.Code, http.StatusOK, "recovered")
+}
+
+func TestCircuitBreakerForgetsOldErrors(t *testing.T) {
+	sfs := &saturatingFS{FS: fstest.MapFS{
+		"css/style1.css": {Data: []byte("body {}\n")},
+	}}
+	a := NewAssetHandlerIoFS(sfs).WithCircuitBreaker(2, 50*time.Millisecond)
+
+	serve := func() int {
+		request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, request)
+		return w.Code
+	}
+
+	sfs.saturated = true
+	isEqual(t, serve(), http.StatusServiceUnavailable, "first")
+
+	// the first error has expired, so the second one doesn't trip the breaker
+	time.Sleep(70 * time.Millisecond)
+	isEqual(t, serve(), http.StatusServiceUnavailable, "second")
+
+	sfs.saturated = false
+	isEqual(t, serve(), http.StatusOK, "closed")
+}
@@ -0,0 +1,71 @@
+package servefiles
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConcurrentExpires is most useful with the race detector, i.e. "go test -race".
+func TestConcurrentExpires(t *testing.T) {
+	const maxAge = 2 * time.Second
+
+	viaField := NewAssetHandler("./assets/")
+	viaField.MaxAge = maxAge // without WithMaxAge
+
+	// a copy must not reuse the Expires value cached for the original's much longer max age
+	original := NewAssetHandler("./assets/").WithMaxAge(365 * 24 * time.Hour)
+	request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+	original.ServeHTTP(httptest.NewRecorder(), request)
+
+	handlers := []*Assets{
+		NewAssetHandler("./assets/").WithMaxAge(maxAge),
+		viaField,
+		NewAssetHandler("./assets/").WithMaxAge(time.Hour).WithMaxAgeClamp(maxAge),
+		original.WithMaxAge(maxAge),
+		original.WithMaxAgeClamp(maxAge),
+	}
+
+	// the requests cross a second boundary, when the cached Expires value is recalculated
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second - 30*time.Millisecond)))
+	stop := time.Now().Add(60 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	errors := make(chan string, 100)
+
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(stop) {
+				for h, a := range handlers {
+					request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+					w := httptest.NewRecorder()
+					before := time.Now().Truncate(time.Second)
+
+					a.ServeHTTP(w, request)
+
+					after := time.Now()
+					if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=2" {
+						errors <- fmt.Sprintf("%d: Cache-Control %s", h, cc)
+						return
+					}
+					expires, err := time.Parse(time.RFC1123, w.Header().Get("Expires"))
+					if err != nil || expires.Before(before.Add(maxAge)) || expires.After(after.Add(maxAge+time.Second)) {
+						errors <- fmt.Sprintf("%d: Expires %s at %s", h, w.Header().Get("Expires"), after.UTC().Format(time.RFC1123))
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errors)
+	for e := range errors {
+		t.Error(e)
+	}
+}
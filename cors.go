@@ -0,0 +1,145 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"net/http"
+	"strings"
+)
+
+// corsMethods is the value of the Access-Control-Allow-Methods header. Only safe methods are
+// ever allowed.
+const corsMethods = "GET, HEAD"
+
+// WithCORS alters the handler so that assets can be fetched cross-origin by scripts on the
+// specified origins, e.g. "https://app.example.com", using CORS. The origin "*" allows any origin.
+//
+// Responses to requests from an allowed origin have the Access-Control-Allow-Origin header.
+// Preflight requests (i.e. OPTIONS with Access-Control-Request-Method) receive a 204 response
+// whose Access-Control-Allow-Methods header only ever lists GET and HEAD, so preflights for any
+// other method fail. The requested headers are only allowed when the requested method is.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithCORS(origins ...string) *Assets {
+	a.corsOrigins = make(List[string], len(origins))
+	for i, o := range origins {
+		a.corsOrigins[i] = strings.TrimSuffix(strings.ToLower(o), "/")
+	}
+	if a.corsCredentials && a.corsOrigins.Contains("*") {
+		panic("CORS credentials cannot be allowed for any origin")
+	}
+	return &a
+}
+
+// WithCORSCredentials alters the handler so that cross-origin requests from the origins allowed
+// by WithCORS may include credentials, such as cookies. Responses to them have
+// "Access-Control-Allow-Credentials: true". Allowing credentials for any origin would be insecure,
+// so this method panics unless WithCORS has been given an explicit list of origins, without "*".
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithCORSCredentials() *Assets {
+	if len(a.corsOrigins) == 0 {
+		panic("CORS credentials require WithCORS with a list of origins")
+	}
+	if a.corsOrigins.Contains("*") {
+		panic("CORS credentials cannot be allowed for any origin")
+	}
+	a.corsCredentials = true
+	return &a
+}
+
+// corsOrigin gets the value of the Access-Control-Allow-Origin header for the request, if its
+// origin is allowed.
+func (a *Assets) corsOrigin(req *http.Request) (string, bool) {
+	origin := req.Header.Get(Origin)
+	if origin == "" {
+		return "", false
+	}
+	if a.corsOrigins.Contains("*") {
+		return "*", true
+	}
+	if a.corsOrigins.Contains(strings.ToLower(origin)) {
+		return origin, true
+	}
+	return "", false
+}
+
+// setCORSHeaders sets the headers for an actual (i.e. not preflight) cross-origin request.
+func (a *Assets) setCORSHeaders(wHeader http.Header, req *http.Request) {
+	allowOrigin, allowed := a.corsOrigin(req)
+	if allowOrigin != "*" {
+		// the response differs between origins
+		wHeader.Add(Vary, Origin)
+	}
+	if allowed {
+		wHeader.Set(AccessControlAllowOrigin, allowOrigin)
+		if a.corsCredentials {
+			wHeader.Set(AccessControlAllowCredentials, "true")
+		}
+	}
+}
+
+// isPreflight is true for CORS preflight requests, which are OPTIONS requests that say which
+// method will be used.
+func isPreflight(req *http.Request) bool {
+	return req.Method == http.MethodOptions && req.Header.Get(Origin) != "" &&
+		req.Header.Get(AccessControlRequestMethod) != ""
+}
+
+// servePreflight responds to a CORS preflight request.
+func (a *Assets) servePreflight(w http.ResponseWriter, req *http.Request) {
+	wHeader := w.Header()
+	wHeader.Set(Allow, allowedMethods)
+	wHeader.Add(Vary, Origin)
+	wHeader.Add(Vary, AccessControlRequestMethod)
+	wHeader.Add(Vary, AccessControlRequestHeaders)
+
+	if allowOrigin, allowed := a.corsOrigin(req); allowed {
+		wHeader.Set(AccessControlAllowOrigin, allowOrigin)
+		wHeader.Set(AccessControlAllowMethods, corsMethods)
+		if a.corsCredentials {
+			wHeader.Set(AccessControlAllowCredentials, "true")
+		}
+
+		method := req.Header.Get(AccessControlRequestMethod)
+		if method == http.MethodGet || method == http.MethodHead {
+			if requested := requestedHeaders(req); requested != "" {
+				wHeader.Set(AccessControlAllowHeaders, requested)
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requestedHeaders gets the Access-Control-Request-Headers as a normalised list, which may have
+// been split across several header lines.
+func requestedHeaders(req *http.Request) string {
+	var names []string
+	for _, name := range commaSeparatedList(strings.Join(req.Header.Values(AccessControlRequestHeaders), ",")) {
+		if name != "" {
+			names = append(names, strings.ToLower(name))
+		}
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,139 @@
+package servefiles
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	cases := []struct {
+		origin, method, headers   string
+		allowOrigin, allowMethods string
+		allowHeaders              string
+	}{
+		{origin: "https://app.example.com", method: "GET", headers: "X-Requested-With, Range",
+			allowOrigin: "https://app.example.com", allowMethods: "GET, HEAD", allowHeaders: "x-requested-with, range"},
+		{origin: "https://app.example.com", method: "HEAD",
+			allowOrigin: "https://app.example.com", allowMethods: "GET, HEAD"},
+		{origin: "https://app.example.com", method: "POST", headers: "Content-Type",
+			allowOrigin: "https://app.example.com", allowMethods: "GET, HEAD"},
+		{origin: "https://app.example.com", method: "DELETE",
+			allowOrigin: "https://app.example.com", allowMethods: "GET, HEAD"},
+		{origin: "https://evil.example.com", method: "GET", headers: "Range"},
+	}
+
+	a := NewAssetHandler("./assets/").WithCORS("https://app.example.com")
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("OPTIONS", "/css/style1.css", nil)
+		request.Header.Set("Origin", test.origin)
+		request.Header.Set("Access-Control-Request-Method", test.method)
+		if test.headers != "" {
+			request.Header.Set("Access-Control-Request-Headers", test.headers)
+		}
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusNoContent, i)
+		isEqual(t, w.Header().Get("Access-Control-Allow-Origin"), test.allowOrigin, i)
+		isEqual(t, w.Header().Get("Access-Control-Allow-Methods"), test.allowMethods, i)
+		isEqual(t, w.Header().Get("Access-Control-Allow-Headers"), test.allowHeaders, i)
+		isEqual(t, w.Header().Values("Vary"), []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}, i)
+		isEqual(t, w.Body.Len(), 0, i)
+	}
+}
+
+func TestCORSActualRequest(t *testing.T) {
+	cases := []struct {
+		a           *Assets
+		origin      string
+		allowOrigin string
+		vary        []string
+	}{
+		{a: NewAssetHandler("./assets/").WithCORS("https://app.example.com"), origin: "https://app.example.com", allowOrigin: "https://app.example.com", vary: []string{"Origin"}},
+		{a: NewAssetHandler("./assets/").WithCORS("https://app.example.com"), origin: "https://evil.example.com", allowOrigin: "", vary: []string{"Origin"}},
+		{a: NewAssetHandler("./assets/").WithCORS("https://app.example.com"), origin: "", allowOrigin: "", vary: []string{"Origin"}},
+		{a: NewAssetHandler("./assets/").WithCORS("*"), origin: "https://any.example.com", allowOrigin: "*", vary: nil},
+		{a: NewAssetHandler("./assets/"), origin: "https://app.example.com", allowOrigin: "", vary: nil},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", "/css/style2.css", nil)
+		if test.origin != "" {
+			request.Header.Set("Origin", test.origin)
+		}
+		w := httptest.NewRecorder()
+
+		test.a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Access-Control-Allow-Origin"), test.allowOrigin, i)
+		isEqual(t, w.Header().Values("Vary"), test.vary, i)
+	}
+}
+
+func TestOptionsWithoutCORS(t *testing.T) {
+	request, _ := http.NewRequest("OPTIONS", "/css/style1.css", nil)
+	request.Header.Set("Origin", "https://app.example.com")
+	request.Header.Set("Access-Control-Request-Method", "GET")
+	w := httptest.NewRecorder()
+
+	NewAssetHandler("./assets/").ServeHTTP(w, request)
+
+	isEqual(t, w.Code, http.StatusNoContent, 0)
+	isEqual(t, w.Header().Get("Allow"), "GET, HEAD, OPTIONS", 0)
+	isEqual(t, w.Header().Get("Access-Control-Allow-Origin"), "", 0)
+	isEqual(t, w.Header().Get("Access-Control-Allow-Methods"), "", 0)
+}
+
+func TestCORSCredentials(t *testing.T) {
+	a := NewAssetHandler("./assets/").WithCORS("https://app.example.com").WithCORSCredentials()
+
+	cases := []struct {
+		method, origin   string
+		code             int
+		allowOrigin      string
+		allowCredentials string
+	}{
+		{method: "GET", origin: "https://app.example.com", code: 200, allowOrigin: "https://app.example.com", allowCredentials: "true"},
+		{method: "OPTIONS", origin: "https://app.example.com", code: 204, allowOrigin: "https://app.example.com", allowCredentials: "true"},
+		{method: "GET", origin: "https://evil.example.com", code: 200},
+		{method: "OPTIONS", origin: "https://evil.example.com", code: 204},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest(test.method, "/css/style2.css", nil)
+		request.Header.Set("Origin", test.origin)
+		if test.method == "OPTIONS" {
+			request.Header.Set("Access-Control-Request-Method", "GET")
+		}
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Access-Control-Allow-Origin"), test.allowOrigin, i)
+		isEqual(t, w.Header().Get("Access-Control-Allow-Credentials"), test.allowCredentials, i)
+	}
+}
+
+func TestCORSCredentialsMisconfiguration(t *testing.T) {
+	cases := []func(){
+		func() { NewAssetHandler("./assets/").WithCORS("*").WithCORSCredentials() },
+		func() {
+			NewAssetHandler("./assets/").WithCORS("https://app.example.com").WithCORSCredentials().WithCORS("*")
+		},
+		func() { NewAssetHandler("./assets/").WithCORSCredentials() },
+	}
+
+	for i, test := range cases {
+		func() {
+			defer func() {
+				isNotEqual(t, recover(), nil, i)
+			}()
+			test()
+		}()
+	}
+}
@@ -0,0 +1,125 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// debugConfig is the configuration reported by DebugHandler. Durations are given as strings,
+// e.g. "1h0m0s".
+type debugConfig struct {
+	UnwantedPrefixSegments int      `json:"unwantedPrefixSegments"`
+	MaxAge                 string   `json:"maxAge"`
+	MaxAgeClamp            string   `json:"maxAgeClamp,omitempty"`
+	DefaultMaxAge          string   `json:"defaultMaxAge,omitempty"`
+	ExpiresThreshold       string   `json:"expiresThreshold,omitempty"`
+	CacheBypassHeader      string   `json:"cacheBypassHeader,omitempty"`
+	Encodings              []string `json:"encodings"`
+	MinCompressionRatio    float64  `json:"minCompressionRatio,omitempty"`
+	NoCompressionHTTP10    bool     `json:"noCompressionHTTP10"`
+	DecompressFallback     bool     `json:"decompressFallback"`
+	DisableDirListing      bool     `json:"disableDirListing"`
+	RedirectTrailingSlash  bool     `json:"redirectTrailingSlash"`
+	AcceptRanges           bool     `json:"acceptRanges"`
+	WeakETagsOnly          bool     `json:"weakETagsOnly"`
+	PrecomputedETags       int      `json:"precomputedETags"`
+	Preloaded              int      `json:"preloaded"`
+	ContentDigest          string   `json:"contentDigest,omitempty"`
+	MaxFileSize            int64    `json:"maxFileSize,omitempty"`
+	AllowedHosts           []string `json:"allowedHosts,omitempty"`
+	CanonicalHost          string   `json:"canonicalHost,omitempty"`
+	HealthPath             string   `json:"healthPath,omitempty"`
+	BuildToken             string   `json:"buildToken,omitempty"`
+	Aliases                int      `json:"aliases"`
+	CustomNotFound         bool     `json:"customNotFound"`
+	CustomMethodNotAllowed bool     `json:"customMethodNotAllowed"`
+}
+
+// DebugHandler gets a handler that reports the effective configuration of the asset handler as
+// JSON. This is intended to be mounted on an internal-only route, so that the deployed
+// configuration can be checked. It does not reveal anything about the files being served.
+func (a *Assets) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set(ContentType, "application/json")
+		w.Header().Set(CacheControl, "no-store")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(a.debugConfig())
+	})
+}
+
+func (a *Assets) debugConfig() debugConfig {
+	cfg := debugConfig{
+		UnwantedPrefixSegments: a.UnwantedPrefixSegments,
+		MaxAge:                 a.MaxAge.String(),
+		CacheBypassHeader:      a.cacheBypassHeader,
+		Encodings:              []string{},
+		MinCompressionRatio:    a.minCompressionRatio,
+		NoCompressionHTTP10:    a.noCompressionHTTP10,
+		DecompressFallback:     a.decompressFallback,
+		DisableDirListing:      a.DisableDirListing,
+		RedirectTrailingSlash:  a.redirectTrailingSlash,
+		AcceptRanges:           a.acceptRanges,
+		WeakETagsOnly:          a.weakETagsOnly,
+		PrecomputedETags:       len(a.etags),
+		Preloaded:              len(a.preloaded),
+		ContentDigest:          a.digestAlgo,
+		MaxFileSize:            a.maxFileSize,
+		AllowedHosts:           a.allowedHosts,
+		HealthPath:             a.healthPath,
+		BuildToken:             a.buildToken,
+		Aliases:                len(a.aliases),
+		CustomNotFound:         a.NotFound != nil,
+		CustomMethodNotAllowed: a.MethodNotAllowed != nil,
+	}
+
+	if a.maxAgeClamp > 0 {
+		cfg.MaxAgeClamp = a.maxAgeClamp.String()
+	}
+	if a.hasDefaultMaxAge {
+		cfg.DefaultMaxAge = a.defaultMaxAge.String()
+	}
+	if a.expiresThreshold > 0 {
+		cfg.ExpiresThreshold = a.expiresThreshold.String()
+	}
+	if a.canonicalHost != "" {
+		cfg.CanonicalHost = a.canonicalHost
+		if a.canonicalScheme != "" {
+			cfg.CanonicalHost = a.canonicalScheme + "://" + a.canonicalHost
+		}
+	}
+
+	// in order of preference; dictionary-compressed variants come first
+	if a.zstdDictionary != nil && a.encodingEnabled(dictionaryEncoding) {
+		cfg.Encodings = append(cfg.Encodings, dictionaryEncoding)
+	}
+	for _, variant := range compressedVariants {
+		if a.encodingEnabled(variant.encoding) {
+			cfg.Encodings = append(cfg.Encodings, variant.encoding)
+		}
+	}
+
+	return cfg
+}
@@ -0,0 +1,44 @@
+package servefiles
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDebugHandler(t *testing.T) {
+	cases := []struct {
+		a         *Assets
+		maxAge    string
+		encodings []string
+	}{
+		{a: NewAssetHandler("./assets/").WithMaxAge(time.Hour), maxAge: "1h0m0s", encodings: []string{"br", "gzip"}},
+		{a: NewAssetHandler("./assets/").WithEnabledEncodings("gzip"), maxAge: "0s", encodings: []string{"gzip"}},
+		{a: NewAssetHandler("./assets/").WithEnabledEncodings(), maxAge: "0s", encodings: []string{}},
+		{a: NewAssetHandler("./assets/").WithZstdDictionary([]byte("dict")), maxAge: "0s", encodings: []string{"dcz", "br", "gzip"}},
+		{a: NewAssetHandler("./assets/").WithZstdDictionary([]byte("dict")).WithEnabledEncodings("gzip"), maxAge: "0s", encodings: []string{"gzip"}},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", "/debug/assets", nil)
+		w := httptest.NewRecorder()
+
+		test.a.StripOff(2).DebugHandler().ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Content-Type"), "application/json", i)
+
+		var cfg map[string]any
+		must(json.Unmarshal(w.Body.Bytes(), &cfg))
+
+		isEqual(t, cfg["maxAge"], test.maxAge, i)
+		isEqual(t, cfg["unwantedPrefixSegments"], float64(2), i)
+		encodings := []string{}
+		for _, e := range cfg["encodings"].([]any) {
+			encodings = append(encodings, e.(string))
+		}
+		isEqual(t, encodings, test.encodings, i)
+	}
+}
@@ -0,0 +1,79 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// WithDebugVariant alters the handler so that debugging tools can be given unminified assets.
+// The suffix is inserted before the file extension of minified assets, e.g. ".min", and the
+// extensions are those of the assets that might be minified; if none are given, ".js" and ".css"
+// are used. Requests for minified assets, e.g. "/js/app.min.js", are served the unminified
+// sibling, e.g. "/js/app.js", when the request has the named header or a cookie with the same
+// name, regardless of its value. Otherwise, or if there is no unminified sibling, the minified
+// asset is served as usual. Responses for all minified assets have a Vary header for the named
+// header and for Cookie.
+//
+// This method panics if the suffix is blank.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithDebugVariant(header, suffix string, extensions ...string) *Assets {
+	if suffix == "" {
+		panic("Blank debug variant suffix")
+	}
+	if len(extensions) == 0 {
+		extensions = []string{".js", ".css"}
+	}
+	a.debugHeader = header
+	a.debugSuffix = suffix
+	a.debugExts = append([]string(nil), extensions...)
+	return &a
+}
+
+// debugVariant gets the resource to serve, which is either the unminified sibling of a minified
+// asset or the resource itself.
+func (a *Assets) debugVariant(wHeader http.Header, req *http.Request, resource string) string {
+	ext := filepath.Ext(resource)
+	if !slices.Contains(a.debugExts, ext) || !strings.HasSuffix(strings.TrimSuffix(resource, ext), a.debugSuffix) {
+		return resource
+	}
+
+	wHeader.Add(Vary, http.CanonicalHeaderKey(a.debugHeader))
+	wHeader.Add(Vary, "Cookie")
+
+	if len(req.Header.Values(a.debugHeader)) == 0 {
+		if _, err := req.Cookie(a.debugHeader); err != nil {
+			return resource
+		}
+	}
+
+	unminified := strings.TrimSuffix(resource, a.debugSuffix+ext) + ext
+	if a.checkResource(unminified, make(http.Header)).code == OK {
+		return unminified
+	}
+	return resource
+}
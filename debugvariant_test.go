@@ -0,0 +1,86 @@
+package servefiles
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rickb777/servefiles/v3/afero2"
+	"github.com/spf13/afero"
+)
+
+func TestDebugVariant(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/js/app.js", []byte("function app() {\n}\n"), 0644)
+	afero.WriteFile(mfs, "/js/app.min.js", []byte("function app(){}"), 0644)
+	afero.WriteFile(mfs, "/js/lib.min.js", []byte("lib()"), 0644)
+	afero.WriteFile(mfs, "/css/site.css", []byte("body {\n}\n"), 0644)
+	afero.WriteFile(mfs, "/css/site.min.css", []byte("body{}"), 0644)
+
+	cases := []struct {
+		path, header, cookie string
+		body, vary           string
+	}{
+		{path: "/js/app.min.js", body: "function app(){}", vary: "X-Debug, Cookie"},
+		{path: "/js/app.min.js", header: "1", body: "function app() {\n}\n", vary: "X-Debug, Cookie"},
+		{path: "/js/app.min.js", cookie: "on", body: "function app() {\n}\n", vary: "X-Debug, Cookie"},
+		{path: "/css/site.min.css", header: "yes", body: "body {\n}\n", vary: "X-Debug, Cookie"},
+		{path: "/css/site.min.css", body: "body{}", vary: "X-Debug, Cookie"},
+
+		// no unminified sibling
+		{path: "/js/lib.min.js", header: "1", body: "lib()", vary: "X-Debug, Cookie"},
+
+		// not minified
+		{path: "/js/app.js", header: "1", body: "function app() {\n}\n", vary: ""},
+	}
+
+	a := NewAssetHandlerFS(mfs).WithDebugVariant("x-debug", ".min")
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.path, nil)
+		if test.header != "" {
+			request.Header.Set("X-Debug", test.header)
+		}
+		if test.cookie != "" {
+			request.AddCookie(&http.Cookie{Name: "x-debug", Value: test.cookie})
+		}
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Body.String(), test.body, i)
+		isEqual(t, strings.Join(w.Header().Values("Vary"), ", "), test.vary, i)
+	}
+}
+
+func TestDebugVariantWithOtherNaming(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/js/app.js", []byte("function app() {\n}\n"), 0644)
+	afero.WriteFile(mfs, "/js/app-min.js", []byte("function app(){}"), 0644)
+	afero.WriteFile(mfs, "/js/mod.mjs", []byte("export function mod() {\n}\n"), 0644)
+	afero.WriteFile(mfs, "/js/mod-min.mjs", []byte("export function mod(){}"), 0644)
+
+	cases := []struct {
+		path, body, vary string
+	}{
+		{path: "/js/mod-min.mjs", body: "export function mod() {\n}\n", vary: "X-Debug, Cookie"},
+		// not one of the extensions
+		{path: "/js/app-min.js", body: "function app(){}", vary: ""},
+	}
+
+	a := NewAssetHandlerFS(mfs).WithDebugVariant("x-debug", "-min", ".mjs")
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.path, nil)
+		request.Header.Set("X-Debug", "1")
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Body.String(), test.body, i)
+		isEqual(t, strings.Join(w.Header().Values("Vary"), ", "), test.vary, i)
+	}
+}
@@ -0,0 +1,95 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"net/http"
+	"time"
+)
+
+// faviconMaxAge is the cache lifetime of the default favicon.
+const faviconMaxAge = 30 * 24 * time.Hour
+
+// robotsMaxAge is the cache lifetime of the default robots.txt; crawlers typically cache it for a
+// day.
+const robotsMaxAge = 24 * time.Hour
+
+// defaultFile is served in place of a well-known file when there is no such file.
+type defaultFile struct {
+	data        []byte
+	contentType string
+	etag        string
+	maxAge      time.Duration
+}
+
+// WithDefaultFavicon alters the handler so that requests for "/favicon.ico" are served with the
+// specified image when there is no such file, instead of receiving 404-not found responses. Browsers
+// request it automatically, so this avoids cluttering the logs. A real favicon file is always
+// served in preference. The default favicon has a long cache lifetime (30 days).
+//
+// The content type would typically be "image/x-icon", "image/png" or "image/svg+xml".
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithDefaultFavicon(data []byte, contentType string) *Assets {
+	a.defaultFiles = withDefaultFile(a.defaultFiles, "/favicon.ico", data, contentType, faviconMaxAge)
+	return &a
+}
+
+// WithDefaultRobots alters the handler so that requests for "/robots.txt" are served with the
+// specified body when there is no such file, instead of receiving 404-not found responses. For
+// example, "User-agent: *\nDisallow: /\n" prevents all crawling. A real robots.txt file is always
+// served in preference. The default robots.txt has a cache lifetime of one day.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithDefaultRobots(body string) *Assets {
+	a.defaultFiles = withDefaultFile(a.defaultFiles, "/robots.txt", []byte(body), "text/plain; charset=utf-8", robotsMaxAge)
+	return &a
+}
+
+// withDefaultFile copies the map so that the original handler is not altered.
+func withDefaultFile(original map[string]*defaultFile, name string, data []byte, contentType string, maxAge time.Duration) map[string]*defaultFile {
+	m := make(map[string]*defaultFile, len(original)+1)
+	for k, v := range original {
+		m[k] = v
+	}
+	sum := sha256.Sum256(data)
+	m[name] = &defaultFile{
+		data:        data,
+		contentType: contentType,
+		etag:        contentEtag(sum[:], int64(len(data))),
+		maxAge:      maxAge,
+	}
+	return m
+}
+
+func (a *Assets) serveDefaultFile(w http.ResponseWriter, req *http.Request, df *defaultFile) {
+	wHeader := w.Header()
+	wHeader.Set(ContentType, df.contentType)
+	wHeader.Set(ETag, df.etag)
+	// any Expires already set for the 404 status would be inconsistent with the default file's max-age
+	wHeader.Del(Expires)
+	a.setMaxAgeHeaders(wHeader, req, a.clamp(df.maxAge))
+	http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(df.data))
+}
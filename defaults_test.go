@@ -0,0 +1,118 @@
+package servefiles
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rickb777/servefiles/v3/afero2"
+	"github.com/spf13/afero"
+)
+
+func TestServeHTTPWithDefaultFavicon(t *testing.T) {
+	fallback := []byte("default icon")
+
+	withFavicon := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(withFavicon, "/favicon.ico", []byte("real icon"), 0644)
+
+	withoutFavicon := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(withoutFavicon, "/index.html", []byte("<html></html>"), 0644)
+
+	cases := []struct {
+		a            *Assets
+		path         string
+		code         int
+		body         string
+		contentType  string
+		cacheControl string
+	}{
+		{a: NewAssetHandlerFS(withoutFavicon).WithDefaultFavicon(fallback, "image/x-icon"), path: "/favicon.ico", code: 200, body: "default icon", contentType: "image/x-icon", cacheControl: "public, max-age=2592000"},
+		{a: NewAssetHandlerFS(withFavicon).WithDefaultFavicon(fallback, "image/x-icon"), path: "/favicon.ico", code: 200, body: "real icon", contentType: "image/vnd.microsoft.icon"},
+		{a: NewAssetHandlerFS(withoutFavicon).WithDefaultFavicon(fallback, "image/x-icon"), path: "/other.ico", code: 404, body: "404 Not found\n", contentType: "text/plain; charset=utf-8"},
+		{a: NewAssetHandlerFS(withoutFavicon), path: "/favicon.ico", code: 404, body: "404 Not found\n", contentType: "text/plain; charset=utf-8"},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+
+		test.a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Body.String(), test.body, i)
+		isEqual(t, w.Header().Get("Content-Type"), test.contentType, i)
+		if test.cacheControl != "" {
+			isEqual(t, w.Header().Get("Cache-Control"), test.cacheControl, i)
+		}
+	}
+}
+
+func TestDefaultFaviconNotModified(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	a := NewAssetHandlerFS(mfs).WithDefaultFavicon([]byte("default icon"), "image/x-icon")
+
+	request, _ := http.NewRequest("GET", "/favicon.ico", nil)
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, request)
+	isEqual(t, w.Code, http.StatusOK, 0)
+	isNotEqual(t, w.Header().Get("ETag"), "", 0)
+
+	request.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	a.ServeHTTP(w, request)
+
+	isEqual(t, w.Code, http.StatusNotModified, 1)
+}
+
+func TestServeHTTPWithDefaultRobots(t *testing.T) {
+	const robots = "User-agent: *\nDisallow: /\n"
+
+	withRobots := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(withRobots, "/robots.txt", []byte("User-agent: *\nAllow: /\n"), 0644)
+
+	withoutRobots := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(withoutRobots, "/index.html", []byte("<html></html>"), 0644)
+
+	cases := []struct {
+		a    *Assets
+		code int
+		body string
+	}{
+		{a: NewAssetHandlerFS(withoutRobots).WithDefaultRobots(robots), code: 200, body: robots},
+		{a: NewAssetHandlerFS(withRobots).WithDefaultRobots(robots), code: 200, body: "User-agent: *\nAllow: /\n"},
+		{a: NewAssetHandlerFS(withoutRobots).WithDefaultFavicon([]byte("icon"), "image/x-icon").WithDefaultRobots(robots), code: 200, body: robots},
+		{a: NewAssetHandlerFS(withoutRobots), code: 404, body: "404 Not found\n"},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", "/robots.txt", nil)
+		w := httptest.NewRecorder()
+
+		test.a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Body.String(), test.body, i)
+		isEqual(t, w.Header().Get("Content-Type"), "text/plain; charset=utf-8", i)
+	}
+}
+
+func TestDefaultRobotsReplacesNotFoundCacheHeaders(t *testing.T) {
+	fs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(fs, "/index.html", []byte("<html></html>"), 0644)
+
+	a := NewAssetHandlerFS(fs).
+		WithDefaultRobots("User-agent: *\n").
+		WithCacheByStatus(map[int]time.Duration{404: time.Minute}).
+		WithExpiresThreshold(time.Hour)
+
+	request, _ := http.NewRequest("GET", "/robots.txt", nil)
+	w := httptest.NewRecorder()
+
+	a.ServeHTTP(w, request)
+
+	isEqual(t, w.Code, http.StatusOK, 0)
+	isEqual(t, w.Header().Get("Cache-Control"), "public, max-age=86400", 0)
+	// the one-day lifetime exceeds the threshold, so there is no Expires header, not even the 404 one
+	isEqual(t, w.Header().Get("Expires"), "", 0)
+}
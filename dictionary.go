@@ -0,0 +1,117 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// dictionaryEncoding is dictionary-compressed Zstandard, defined by RFC9842.
+	dictionaryEncoding = "dcz"
+
+	// dictionaryExt is the file extension of the dictionary-compressed variants.
+	dictionaryExt = ".dcz"
+)
+
+// dczMagic starts every dcz stream; it is followed by the SHA-256 hash of the dictionary.
+var dczMagic = []byte{0x5e, 0x2a, 0x4d, 0x18, 0x20, 0x00, 0x00, 0x00}
+
+type zstdDictionary struct {
+	hash      []byte
+	available string // the expected Available-Dictionary header
+}
+
+// WithZstdDictionary alters the handler so that clients that have the specified shared dictionary
+// are served variants compressed with it. Shared dictionaries greatly improve compression for
+// many small, similar files. The variants are ".dcz" files, e.g. "app.js.dcz", which are Zstandard
+// files produced using the dictionary, e.g. by "zstd -D dictionary". The distinct extension keeps
+// them apart from ordinary ".zst" files, which clients without the dictionary cannot decode. They
+// are served using compression dictionary transport (RFC9842) to clients that send "dcz" in
+// Accept-Encoding and the hash of this dictionary in Available-Dictionary. The response has
+// "Content-Encoding: dcz" and its body is the file with the required 40-byte header prepended,
+// which needs the file to be read into memory. These variants are preferred to any other
+// compressed variant. Like the others, they are subject to WithEnabledEncodings (as "dcz"),
+// WithMinCompressionRatio, WithNoTransform and WithOriginalLastModified.
+//
+// Clients only obtain the dictionary if it is served with a Use-As-Dictionary header, which is not
+// done by this option (see WithHeaderRule). This method panics if the dictionary is empty.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithZstdDictionary(dictionary []byte) *Assets {
+	if len(dictionary) == 0 {
+		panic("Empty zstd dictionary")
+	}
+	hash := sha256.Sum256(dictionary)
+	a.zstdDictionary = &zstdDictionary{
+		hash:      hash[:],
+		available: ":" + base64.StdEncoding.EncodeToString(hash[:]) + ":",
+	}
+	return &a
+}
+
+// dictionaryVariant sets the headers for the dictionary-compressed variant of a resource, if the
+// client can accept it and the variant exists.
+func (a *Assets) dictionaryVariant(wHeader http.Header, req *http.Request, resource, typeName string, acceptEncoding List[string]) (string, bool) {
+	if !a.encodingEnabled(dictionaryEncoding) || !acceptEncoding.Contains(dictionaryEncoding) ||
+		strings.TrimSpace(req.Header.Get(AvailableDictionary)) != a.zstdDictionary.available {
+		return "", false
+	}
+
+	compressed := resource + dictionaryExt
+	fdc := a.checkResource(compressed, wHeader)
+	if fdc.code != OK {
+		return "", false
+	}
+
+	size := int64(len(dczMagic)+len(a.zstdDictionary.hash)) + fdc.fi.Size()
+	if a.minCompressionRatio > 0 && !a.compressionWorthwhile(a.originalSize(resource), size) {
+		return "", false
+	}
+
+	a.setCompressedHeaders(wHeader, resource, typeName, dictionaryEncoding)
+	wHeader.Add(Vary, AvailableDictionary)
+	// weak etag because the representation is not the original file but a compressed variant
+	wHeader.Set(ETag, "W/"+a.compositeEtag(wHeader, resource, a.compressedEtag(compressed, dictionaryEncoding, fdc.fi), fdc.fi.ModTime()))
+	wHeader.Set(ContentLength, strconv.FormatInt(size, 10))
+	return compressed, true
+}
+
+// serveDictionaryCompressed serves a dictionary-compressed variant, with its dcz header.
+func (a *Assets) serveDictionaryCompressed(w http.ResponseWriter, req *http.Request, resource string, modTime time.Time) {
+	content, modTime, err := a.readResource(resource, modTime)
+	if err != nil {
+		Debugf("Assets serve file %s %v\n", resource, err)
+		a.httpError(w, ServiceUnavailable, req.Method)
+		return
+	}
+
+	stream := concat(dczMagic, a.zstdDictionary.hash, content)
+	http.ServeContent(w, req, resource, modTime, bytes.NewReader(stream))
+}
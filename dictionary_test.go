@@ -0,0 +1,106 @@
+package servefiles
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rickb777/servefiles/v3/afero2"
+	"github.com/spf13/afero"
+)
+
+func TestZstdDictionary(t *testing.T) {
+	dictionary := []byte("function prototype return")
+	hash := sha256.Sum256(dictionary)
+	available := ":" + base64.StdEncoding.EncodeToString(hash[:]) + ":"
+	dczBody := string([]byte{0x5e, 0x2a, 0x4d, 0x18, 0x20, 0, 0, 0}) + string(hash[:]) + "zstd frame"
+
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/js/app.js", []byte("function app() { return 1 }\n"), 0644)
+	afero.WriteFile(mfs, "/js/app.js.dcz", []byte("zstd frame"), 0644)
+	afero.WriteFile(mfs, "/js/app.js.gz", []byte("gzipped"), 0644)
+
+	cases := []struct {
+		encoding, available string
+		conEnc, body, vary  string
+	}{
+		{encoding: "gzip, br, zstd, dcz", available: available, conEnc: "dcz", body: dczBody, vary: "Accept-Encoding, Available-Dictionary"},
+		{encoding: "dcz", available: " " + available, conEnc: "dcz", body: dczBody, vary: "Accept-Encoding, Available-Dictionary"},
+		{encoding: "gzip, dcz", available: ":AAAA:", conEnc: "gzip", body: "gzipped", vary: "Accept-Encoding"},
+		{encoding: "gzip, dcz", available: "", conEnc: "gzip", body: "gzipped", vary: "Accept-Encoding"},
+		{encoding: "gzip", available: available, conEnc: "gzip", body: "gzipped", vary: "Accept-Encoding"},
+		{encoding: "xx", available: available, conEnc: "", body: "function app() { return 1 }\n", vary: ""},
+	}
+
+	a := NewAssetHandlerFS(mfs).WithZstdDictionary(dictionary)
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", "/js/app.js", nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		if test.available != "" {
+			request.Header.Set("Available-Dictionary", test.available)
+		}
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Content-Encoding"), test.conEnc, i)
+		isEqual(t, w.Header().Get("Content-Type"), "text/javascript; charset=utf-8", i)
+		isEqual(t, w.Header().Get("Content-Length"), strconv.Itoa(len(test.body)), i)
+		isEqual(t, strings.Join(w.Header().Values("Vary"), ", "), test.vary, i)
+		isEqual(t, w.Body.String(), test.body, i)
+		if test.conEnc == "dcz" {
+			isEqual(t, strings.HasPrefix(w.Header().Get("ETag"), `W/"`), true, i)
+		}
+	}
+}
+
+func TestZstdDictionaryHonoursCompressionOptions(t *testing.T) {
+	dictionary := []byte("function prototype return")
+	hash := sha256.Sum256(dictionary)
+	available := ":" + base64.StdEncoding.EncodeToString(hash[:]) + ":"
+
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/js/app.js", []byte("function app() { return 1 }\n"), 0644)
+	afero.WriteFile(mfs, "/js/app.js.gz", []byte("gzipped"), 0644)
+	afero.WriteFile(mfs, "/js/app.js.zst", []byte("plain zstd"), 0644)
+	afero.WriteFile(mfs, "/js/app.js.dcz", []byte("zstd frame"), 0644)
+	original := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	mfs.Inner.Chtimes("/js/app.js", original, original)
+
+	a := NewAssetHandlerFS(mfs).WithZstdDictionary(dictionary)
+
+	cases := []struct {
+		a                             *Assets
+		conEnc, cacheControl, lastMod string
+	}{
+		{a: a.WithEnabledEncodings("gzip"), conEnc: "gzip"},
+		{a: a.WithEnabledEncodings("dcz"), conEnc: "dcz"},
+		// the dcz header makes the variant bigger than the original file
+		{a: a.WithMinCompressionRatio(0.1), conEnc: "gzip"},
+		{a: a.WithNoTransform(), conEnc: "dcz", cacheControl: "no-transform"},
+		{a: a.WithOriginalLastModified(), conEnc: "dcz", lastMod: original.Format(http.TimeFormat)},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", "/js/app.js", nil)
+		request.Header.Set("Accept-Encoding", "gzip, dcz")
+		request.Header.Set("Available-Dictionary", available)
+		w := httptest.NewRecorder()
+
+		test.a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Content-Encoding"), test.conEnc, i)
+		isEqual(t, w.Header().Get("Cache-Control"), test.cacheControl, i)
+		if test.lastMod != "" {
+			isEqual(t, w.Header().Get("Last-Modified"), test.lastMod, i)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// digestAlgorithms lists the supported Content-Digest algorithms (see RFC9530).
+var digestAlgorithms = map[string]func() hash.Hash{
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// hashCache holds content hashes so that files are only read and hashed once. Entries are
+// discarded when the file's modification time or size change.
+type hashCache struct {
+	mu      sync.Mutex
+	entries map[string]hashEntry
+}
+
+type hashEntry struct {
+	modTime time.Time
+	size    int64
+	sum     []byte
+}
+
+func newHashCache() *hashCache {
+	return &hashCache{entries: make(map[string]hashEntry)}
+}
+
+// WithContentDigest alters the handler so that a Content-Digest header (see RFC9530) is set on
+// each asset served. The algorithm is either "sha-256" or "sha-512". For compressed variants, the
+// digest covers the compressed bytes, i.e. the content actually sent. The digest is omitted for
+// range requests because it would not match the partial content.
+//
+// Each file is read and hashed once; the result is cached until the file changes.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithContentDigest(algo string) *Assets {
+	if _, exists := digestAlgorithms[algo]; !exists {
+		panic("Unsupported digest algorithm " + algo)
+	}
+	a.digestAlgo = algo
+	return &a
+}
+
+func (a *Assets) setContentDigest(wHeader http.Header, req *http.Request, resource string, fi os.FileInfo) {
+	if a.digestAlgo == "" || req.Header.Get("Range") != "" {
+		return
+	}
+
+	sum, err := a.contentHash(a.digestAlgo, resource, fi)
+	if err != nil {
+		Debugf("Assets content digest %s %v\n", resource, err)
+		return
+	}
+
+	wHeader.Set(ContentDigest, a.digestAlgo+"=:"+base64.StdEncoding.EncodeToString(sum)+":")
+}
+
+// contentHash gets the hash of a file's content, using the cached value if there is one.
+func (a *Assets) contentHash(algo, resource string, fi os.FileInfo) ([]byte, error) {
+	key := algo + " " + resource
+
+	a.hashes.mu.Lock()
+	entry, exists := a.hashes.entries[key]
+	a.hashes.mu.Unlock()
+
+	if exists && entry.modTime.Equal(fi.ModTime()) && entry.size == fi.Size() {
+		return entry.sum, nil
+	}
+
+	h := digestAlgorithms[algo]()
+
+	if mf, isMem := fi.(*memFile); isMem {
+		h.Write(mf.content)
+	} else {
+		f, err := a.fs.Open(removeLeadingSlash(resource))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		if _, err = io.Copy(h, f); err != nil {
+			return nil, err
+		}
+	}
+
+	entry = hashEntry{modTime: fi.ModTime(), size: fi.Size(), sum: h.Sum(nil)}
+
+	a.hashes.mu.Lock()
+	a.hashes.entries[key] = entry
+	a.hashes.mu.Unlock()
+
+	return entry.sum, nil
+}
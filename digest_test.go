@@ -0,0 +1,77 @@
+package servefiles
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func digestOf(algo, name string) string {
+	content, err := os.ReadFile(name)
+	must(err)
+	switch algo {
+	case "sha-256":
+		sum := sha256.Sum256(content)
+		return algo + "=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+	case "sha-512":
+		sum := sha512.Sum512(content)
+		return algo + "=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+	}
+	panic(algo)
+}
+
+func TestServeHTTPWithContentDigest(t *testing.T) {
+	cases := []struct {
+		algo, url, encoding, path string
+		rangeHeader               string
+	}{
+		{algo: "sha-256", url: "/css/style2.css", encoding: "xx", path: "assets/css/style2.css"},
+		{algo: "sha-256", url: "/css/style1.css", encoding: "gzip", path: "assets/css/style1.css.gz"},
+		{algo: "sha-256", url: "/css/style1.css", encoding: "br", path: "assets/css/style1.css.br"},
+		{algo: "sha-512", url: "/js/script1.js", encoding: "xx", path: "assets/js/script1.js"},
+		{algo: "sha-256", url: "/", encoding: "xx", path: "assets/index.html"},
+		{algo: "sha-256", url: "/css/style2.css", encoding: "xx", rangeHeader: "bytes=0-3"},
+	}
+
+	for i, test := range cases {
+		a := NewAssetHandler("./assets/").WithContentDigest(test.algo)
+
+		// the second time around, the cached hash is used
+		for j := 0; j < 2; j++ {
+			request, _ := http.NewRequest("GET", test.url, nil)
+			request.Header.Set("Accept-Encoding", test.encoding)
+			if test.rangeHeader != "" {
+				request.Header.Set("Range", test.rangeHeader)
+			}
+			w := httptest.NewRecorder()
+
+			a.ServeHTTP(w, request)
+
+			if test.path != "" {
+				isEqual(t, w.Code, http.StatusOK, i)
+				isEqual(t, w.Header().Get("Content-Digest"), digestOf(test.algo, test.path), i)
+			} else {
+				isEqual(t, w.Code, http.StatusPartialContent, i)
+				isEqual(t, w.Header().Get("Content-Digest"), "", i)
+			}
+		}
+	}
+}
+
+func TestServeHTTPWithContentDigestPreloaded(t *testing.T) {
+	a, err := NewAssetHandler("./assets/").WithContentDigest("sha-256").PreloadCompressed([]string{"js/script1.js"})
+	must(err)
+
+	request, _ := http.NewRequest("GET", "/js/script1.js", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+
+	a.ServeHTTP(w, request)
+
+	isEqual(t, w.Code, http.StatusOK, 0)
+	isEqual(t, w.Header().Get("Content-Digest"), digestOf("sha-256", "assets/js/script1.js.gz"), 0)
+}
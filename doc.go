@@ -41,6 +41,10 @@ which it will serve if present. Otherwise it will serve the 'normal' file.
 This has many benefits: fewer bytes are read from the disk, a smaller memory footprint is needed in the server,
 less data copying happens, fewer bytes are sent across the network, etc.
 
+Responses for compressed files have 'Vary: Accept-Encoding'. Behind a shared cache, it is best to normalise the
+Accept-Encoding request header upstream, e.g. to just "br", "gzip" or nothing, because otherwise the many
+different values sent by browsers fragment the cache. See also WithCanonicalEncodingVary.
+
 You should not attempt to gzip already-compressed files, such as PNG, JPEG, SVGZ, etc.
 
 Very small files (e.g. less than 1kb) gain little from compression because they may be small enough to fit
@@ -57,6 +61,13 @@ or weak tags are used for plain or gzipped files respectively (the reason is tha
 compressed with different levels of compression, a weak Etag indicates there is not a strict match for the
 file's content).
 
+The 'Last-Modified' header is also set, so clients may send 'If-Modified-Since' as well as 'If-None-Match'.
+When both are present, 'If-None-Match' takes precedence and 'If-Modified-Since' is ignored, as required by
+RFC9110. This applies equally to compressed variants.
+
+'If-None-Match' always uses the weak comparison defined by RFC9110, so a tag that has been weakened
+along the way, e.g. by an intermediary that alters the byte stream, still gives a 304 response.
+
 For further information see RFC9110 https://tools.ietf.org/html/rfc9110.
 
 # Cache Control
@@ -90,6 +101,13 @@ being new, and they will later drop old versions from their cache regardless of
 
 So you get the far-future lifespan combined with being able to push out changed assets as often as you need to.
 
+# Query Strings
+
+The query string plays no part in choosing the asset: "/app.js?v=1" and "/app.js?v=2" are both served from the
+same file, with the same ETag. So cache-busting query parameters work, but each distinct query is a separate entry
+in any cache that includes the query in its key. Path segments (see above) avoid this; otherwise, configure the
+cache to ignore the query for asset URLs.
+
 # Example Usage
 
 To serve files with a ten-year expiry, this creates a suitably-configured handler:
@@ -0,0 +1,88 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxDPR limits the variants that are looked for; no current screens exceed this.
+const maxDPR = 4
+
+// WithDPRVariants alters the handler so that high-resolution variants of images are served to
+// clients that send a device pixel ratio hint, i.e. a "Sec-CH-DPR" or "DPR" header. The naming
+// convention gives the suffix inserted before the file extension, where %d is the pixel ratio.
+// For example, with the convention "@%dx", a request for "/img/icon.png" with "DPR: 2" is served
+// from "/img/icon@2x.png" if it exists. If there is no variant for the requested ratio, the
+// largest variant with a lower ratio is used, or else the original image.
+//
+// When a variant is served, the response has a Content-DPR header. Responses for all images
+// have "Vary: Sec-CH-DPR, DPR". Note that browsers only send these hints if the server asks for
+// them using an Accept-CH header.
+//
+// This method panics if the convention does not contain exactly one %d.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithDPRVariants(convention string) *Assets {
+	if strings.Count(convention, "%d") != 1 || strings.Count(convention, "%") != 1 {
+		panic(fmt.Sprintf("Bad DPR variant convention %q", convention))
+	}
+	a.dprConvention = convention
+	return &a
+}
+
+// dprVariant gets the resource to serve for the client's device pixel ratio, which is either a
+// high-resolution variant or the original resource.
+func (a *Assets) dprVariant(wHeader http.Header, req *http.Request, resource string) string {
+	if !strings.HasPrefix(a.contentType(resource), "image/") {
+		return resource
+	}
+
+	wHeader.Add(Vary, SecCHDPR)
+	wHeader.Add(Vary, DPR)
+
+	hint := req.Header.Get(SecCHDPR)
+	if hint == "" {
+		hint = req.Header.Get(DPR)
+	}
+	dpr, err := strconv.ParseFloat(strings.TrimSpace(hint), 64)
+	if err != nil || math.IsNaN(dpr) {
+		return resource
+	}
+
+	ext := filepath.Ext(resource)
+	base := strings.TrimSuffix(resource, ext)
+	for ratio := min(int(math.Round(dpr)), maxDPR); ratio >= 2; ratio-- {
+		variant := base + fmt.Sprintf(a.dprConvention, ratio) + ext
+		if a.checkResource(variant, make(http.Header)).code == OK {
+			wHeader.Set(ContentDPR, strconv.Itoa(ratio))
+			return variant
+		}
+	}
+	return resource
+}
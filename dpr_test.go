@@ -0,0 +1,58 @@
+package servefiles
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rickb777/servefiles/v3/afero2"
+	"github.com/spf13/afero"
+)
+
+func TestServeHTTPWithDPRVariants(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/img/icon.png", []byte("1x"), 0644)
+	afero.WriteFile(mfs, "/img/icon@2x.png", []byte("2x"), 0644)
+	afero.WriteFile(mfs, "/img/logo.png", []byte("logo"), 0644)
+	afero.WriteFile(mfs, "/img/photo.jpg", []byte("1x"), 0644)
+	afero.WriteFile(mfs, "/img/photo-3x.jpg", []byte("3x"), 0644)
+	afero.WriteFile(mfs, "/js/app.js", []byte("1x"), 0644)
+	afero.WriteFile(mfs, "/js/app@2x.js", []byte("2x"), 0644)
+
+	a := NewAssetHandlerFS(mfs).WithDPRVariants("@%dx")
+
+	cases := []struct {
+		a                 *Assets
+		path, header, dpr string
+		body              string
+		contentDPR        string
+		vary              []string
+	}{
+		{a: a, path: "/img/icon.png", header: "DPR", dpr: "2", body: "2x", contentDPR: "2", vary: []string{"Sec-CH-DPR", "DPR"}},
+		{a: a, path: "/img/icon.png", header: "Sec-CH-DPR", dpr: "2", body: "2x", contentDPR: "2", vary: []string{"Sec-CH-DPR", "DPR"}},
+		{a: a, path: "/img/icon.png", header: "DPR", dpr: "3", body: "2x", contentDPR: "2", vary: []string{"Sec-CH-DPR", "DPR"}},
+		{a: a, path: "/img/icon.png", header: "DPR", dpr: "2.2", body: "2x", contentDPR: "2", vary: []string{"Sec-CH-DPR", "DPR"}},
+		{a: a, path: "/img/icon.png", header: "DPR", dpr: "1", body: "1x", vary: []string{"Sec-CH-DPR", "DPR"}},
+		{a: a, path: "/img/icon.png", header: "DPR", dpr: "x", body: "1x", vary: []string{"Sec-CH-DPR", "DPR"}},
+		{a: a, path: "/img/icon.png", body: "1x", vary: []string{"Sec-CH-DPR", "DPR"}},
+		{a: a, path: "/img/logo.png", header: "DPR", dpr: "2", body: "logo", vary: []string{"Sec-CH-DPR", "DPR"}},
+		{a: a, path: "/js/app.js", header: "DPR", dpr: "2", body: "1x"},
+		{a: NewAssetHandlerFS(mfs).WithDPRVariants("-%dx"), path: "/img/photo.jpg", header: "DPR", dpr: "3", body: "3x", contentDPR: "3", vary: []string{"Sec-CH-DPR", "DPR"}},
+		{a: NewAssetHandlerFS(mfs), path: "/img/icon.png", header: "DPR", dpr: "2", body: "1x"},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.path, nil)
+		if test.header != "" {
+			request.Header.Set(test.header, test.dpr)
+		}
+		w := httptest.NewRecorder()
+
+		test.a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Body.String(), test.body, i)
+		isEqual(t, w.Header().Get("Content-DPR"), test.contentDPR, i)
+		isEqual(t, w.Header().Values("Vary"), test.vary, i)
+	}
+}
@@ -84,6 +84,14 @@ func (a EchoAssets) WithNotFound(notFound http.Handler) *EchoAssets {
 // registered using a catch-all path such as "/files/*". The same
 // match-any pattern can be passed in, in which case it is stripped off
 // the leading part of the URL path seem by the asset handler.
+//
+// All the fixed segments of the path are stripped automatically, however many
+// there are, so StripOff is not needed for them. StripOff is only needed to
+// remove further segments that follow, such as a version number.
+//
+// A request for the mount point itself (e.g. "/files/") is a request for the
+// root directory, so it is served the root index.html or a directory listing,
+// or 404-not found if DisableDirListing is set and there is no index.
 func (a *EchoAssets) HandlerFunc(path string) echo.HandlerFunc {
 	trim := 0
 	if strings.HasSuffix(path, "/*") {
@@ -95,17 +103,32 @@ func (a *EchoAssets) HandlerFunc(path string) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		req := c.Request()
 		req.URL.Path = req.URL.Path[trim:]
+		if req.URL.Path == "" {
+			// the bare mount point is the root directory
+			req.URL.Path = "/"
+		}
 		(*servefiles.Assets)(a).ServeHTTP(c.Response(), c.Request())
 		return nil
 	}
 }
 
+// Middleware gets the asset handler as Echo middleware. Each GET or HEAD request is first
+// tried against the assets; if no matching asset is found, the request falls through to the
+// next handler instead of receiving a 404 response. This allows a static-first-then-dynamic
+// arrangement of routes. Other request methods always fall through.
+//
+// Unlike HandlerFunc, there is no catch-all path so any leading segments to be ignored must
+// be specified using StripOff.
+func (a *EchoAssets) Middleware() echo.MiddlewareFunc {
+	return echo.WrapMiddleware((*servefiles.Assets)(a).Middleware())
+}
+
 // Register registers the asset handler with an Echo engine using the specified
 // path to handle GET and HEAD requests.
 //
 // The handler is registered using a catch-all path such as "/files/*". This
 // pattern will be stripped off the leading part of the URL path seem by the
-// asset handler when determining the file to be served.
+// asset handler when determining the file to be served; see HandlerFunc.
 func (a *EchoAssets) Register(e *echo.Echo, path string) {
 	if !strings.HasSuffix(path, "/*") {
 		panic(path + ": path must end /*")
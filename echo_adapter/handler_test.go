@@ -164,3 +164,109 @@ func TestHandlerFunc_with_EmbedFS(t *testing.T) {
 
 	g.Expect(w.Code).To(Equal(404))
 }
+
+func TestMiddleware_falls_through(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	sub, err := fs.Sub(testdata.TestDataFS, "assets")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	h := echo_adapter.NewAssetHandlerIoFS(sub).
+		WithMaxAge(time.Hour).
+		WithNotFound(http.NotFoundHandler()) // not used by the middleware
+
+	router := echo.New()
+	router.Use(h.Middleware())
+	router.GET("/api/x", func(c echo.Context) error {
+		return c.String(http.StatusOK, "dynamic")
+	})
+
+	r, _ := http.NewRequest(http.MethodGet, "http://localhost/js/script1.js", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	g.Expect(w.Code).To(Equal(200))
+	g.Expect(w.Header().Get("Content-Type")).To(Equal(javascriptMimeType))
+	g.Expect(w.Header().Get("Expires")).NotTo(Equal(""))
+	g.Expect(w.Body.Len()).To(Equal(19))
+
+	r, _ = http.NewRequest(http.MethodGet, "http://localhost/api/x", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	g.Expect(w.Code).To(Equal(200))
+	g.Expect(w.Header().Get("Expires")).To(Equal(""))
+	g.Expect(w.Header().Get("Cache-Control")).To(Equal(""))
+	g.Expect(w.Body.String()).To(Equal("dynamic"))
+
+	r, _ = http.NewRequest(http.MethodGet, "http://localhost/api/y", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	g.Expect(w.Code).To(Equal(404))
+	g.Expect(w.Header().Get("Expires")).To(Equal(""))
+}
+
+func TestRegister_multi_segment_prefix_without_StripOff(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	sub, err := fs.Sub(testdata.TestDataFS, "assets")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	h := echo_adapter.NewAssetHandlerIoFS(sub)
+
+	router := echo.New()
+	h.Register(router, "/static/app/assets/*")
+
+	r, _ := http.NewRequest(http.MethodGet, "http://localhost/static/app/assets/js/script1.js", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	g.Expect(w.Code).To(Equal(200))
+	g.Expect(w.Header().Get("Content-Type")).To(Equal(javascriptMimeType))
+	g.Expect(w.Body.Len()).To(Equal(19))
+
+	r, _ = http.NewRequest(http.MethodGet, "http://localhost/static/app/assets/css/style2.css", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	g.Expect(w.Code).To(Equal(200))
+	g.Expect(w.Body.Len()).To(Equal(34))
+}
+
+func TestRegister_mount_root(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	withIndex, err := fs.Sub(testdata.TestDataFS, "assets")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	withoutIndex := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(withoutIndex, "/a.txt", []byte("a"), 0644)
+
+	unlisted := echo_adapter.NewAssetHandlerFS(withoutIndex)
+	unlisted.DisableDirListing = true
+
+	cases := []struct {
+		h    *echo_adapter.EchoAssets
+		url  string
+		code int
+		body string
+	}{
+		{h: echo_adapter.NewAssetHandlerIoFS(withIndex), url: "http://localhost/files/", code: 200, body: "index page"},
+		{h: echo_adapter.NewAssetHandlerFS(withoutIndex), url: "http://localhost/files/", code: 200, body: "a.txt"},
+		{h: unlisted, url: "http://localhost/files/", code: 404},
+	}
+
+	for _, test := range cases {
+		router := echo.New()
+		test.h.Register(router, "/files/*")
+
+		r, _ := http.NewRequest(http.MethodGet, test.url, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		g.Expect(w.Code).To(Equal(test.code), test.url)
+		g.Expect(w.Header().Get("Location")).To(Equal(""), test.url)
+		g.Expect(w.Body.String()).To(ContainSubstring(test.body), test.url)
+	}
+}
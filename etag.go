@@ -0,0 +1,258 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// WithCompressedContentETags alters the handler so that the ETags of compressed variants are
+// derived from their content instead of their modification time and size. When the build
+// process is deterministic, regenerated compressed files are identical to the previous ones except
+// for their modification time, so this avoids needlessly invalidating the clients' caches.
+//
+// Each compressed file is read and hashed once; the result is cached until the file changes.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithCompressedContentETags() *Assets {
+	a.compressedContentETags = true
+	return &a
+}
+
+// WithHybridETag alters the handler so that files smaller than the threshold (in bytes) get
+// ETags derived from their content, whereas larger files keep the cheap ETags derived from their
+// modification time and size. Content-derived ETags are the same on every replica of a server and
+// survive redeployment of unaltered files, but each file has to be read to calculate them. This
+// is a compromise between the two. Zero disables the hybrid policy, which is the default.
+//
+// Each small file is read and hashed once; the result is cached until the file changes.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithHybridETag(threshold int64) *Assets {
+	if threshold < 0 {
+		panic("Negative ETag threshold")
+	}
+	a.hybridETagThreshold = threshold
+	return &a
+}
+
+// WithEncodingInETag alters the handler so that the ETags of compressed variants include the
+// content encoding, e.g. W/"5f3a-1c-gzip". The ETags of the different encodings of each asset are
+// then always distinct. This guards against broken caches that ignore the Vary header and would
+// otherwise treat a compressed response as a valid copy of the original file.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithEncodingInETag() *Assets {
+	a.encodingInETag = true
+	return &a
+}
+
+// WithCompositeETag alters the handler so that the ETag of a manifest file, e.g. a JSON description
+// of a sprite atlas, is derived from its own ETag and those of the files it references. So whenever
+// any referenced file changes, the manifest's ETag changes too and clients fetch it again. Likewise,
+// its Last-Modified header gives the latest modification time of the manifest and the files it
+// references. The paths are relative to the root of the handler's filesystem, e.g.
+// "/atlas/tiles.json".
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithCompositeETag(manifest string, references ...string) *Assets {
+	m := make(map[string][]string, len(a.compositeETags)+1)
+	for k, v := range a.compositeETags {
+		m[k] = v
+	}
+	refs := make([]string, len(references))
+	for i, r := range references {
+		refs[i] = "/" + removeLeadingSlash(r)
+	}
+	m["/"+removeLeadingSlash(manifest)] = refs
+	a.compositeETags = m
+	return &a
+}
+
+// compositeEtag combines the ETag of a manifest with the ETags of the files it references, if it
+// has any, and sets the Last-Modified header to the latest of their modification times. Otherwise,
+// the ETag is returned unchanged.
+func (a *Assets) compositeEtag(wHeader http.Header, resource, etag string, modTime time.Time) string {
+	refs, exists := a.compositeETags[resource]
+	if !exists {
+		return etag
+	}
+
+	if lm := a.lastModified(wHeader); !lm.IsZero() {
+		// e.g. the original file's time, in place of the compressed file's time
+		modTime = lm
+	}
+
+	h := sha256.New()
+	io.WriteString(h, etag)
+	for _, ref := range refs {
+		fd := a.checkResource(ref, make(http.Header))
+		if fd.code == OK {
+			io.WriteString(h, "\n"+a.etag(fd.resource, fd.fi))
+			if fd.fi.ModTime().After(modTime) {
+				modTime = fd.fi.ModTime()
+			}
+		} else {
+			// a missing file also alters the ETag
+			io.WriteString(h, "\n-")
+		}
+	}
+
+	if !modTime.IsZero() {
+		// ServeHTTP uses this in place of the manifest's own modification time
+		wHeader.Set(LastModified, modTime.UTC().Format(http.TimeFormat))
+	}
+	return fmt.Sprintf(`"%x"`, h.Sum(nil)[:16])
+}
+
+// etagAlgorithm is the hash used for content-derived ETags.
+const etagAlgorithm = "sha-256"
+
+// PrecomputeETags alters the handler so that ETags are derived from the content of the assets
+// instead of their modification time and size. Every file in the filesystem is read and hashed
+// now, so this is intended for immutable filesystems such as embed.FS. Files that are added or
+// altered later are not noticed; they continue to be served with their old ETags, or with the
+// usual ETags if they are new.
+//
+// Files without a modification time (e.g. in embed.FS) always get content-derived ETags; this
+// method simply moves the cost of hashing them to startup.
+//
+// The returned handler is a new copy of the original one. An error is returned if any of the
+// files cannot be read.
+func (a Assets) PrecomputeETags() (*Assets, error) {
+	etags := make(map[string]string)
+
+	err := fs.WalkDir(a.fs, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		f, err := a.fs.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		h := digestAlgorithms[etagAlgorithm]()
+		size, err := io.Copy(h, f)
+		if err != nil {
+			return err
+		}
+
+		etags["/"+name] = contentEtag(h.Sum(nil), size)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	a.etags = etags
+	return &a, nil
+}
+
+// etag gets the ETag for a resource, using the precomputed value if there is one.
+func (a *Assets) etag(resource string, fi os.FileInfo) string {
+	if etag, exists := a.etags[resource]; exists {
+		return etag
+	}
+
+	if fi != nil && (fi.ModTime().IsZero() || fi.Size() < a.hybridETagThreshold) {
+		// Some filesystems (notably embed.FS) have no modification times, so calculateEtag
+		// would give the same ETag to all files of the same size. The content is used instead.
+		// Small files also use the content if the hybrid policy is enabled.
+		sum, err := a.contentHash(etagAlgorithm, resource, fi)
+		if err == nil {
+			return contentEtag(sum, fi.Size())
+		}
+		Debugf("Assets etag %s %v\n", resource, err)
+	}
+
+	return calculateEtag(fi)
+}
+
+// compressedEtag gets the ETag for a compressed variant, which is content-derived if required.
+func (a *Assets) compressedEtag(resource, encoding string, fi os.FileInfo) string {
+	etag := ""
+	if a.compressedContentETags {
+		sum, err := a.contentHash(etagAlgorithm, resource, fi)
+		if err == nil {
+			etag = contentEtag(sum, fi.Size())
+		} else {
+			Debugf("Assets etag %s %v\n", resource, err)
+		}
+	}
+	if etag == "" {
+		etag = a.etag(resource, fi)
+	}
+	if a.encodingInETag && strings.HasSuffix(etag, `"`) {
+		etag = strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+	}
+	return etag
+}
+
+// contentEtag formats a content hash as an ETag, abbreviated because it need not be
+// cryptographically strong.
+func contentEtag(sum []byte, size int64) string {
+	return fmt.Sprintf(`"%x-%x"`, sum[:16], size)
+}
+
+// notModified is true if the request's If-None-Match matches the ETag of the response (using the
+// weak comparison required by RFC9110). Requests that have other preconditions are excluded; they
+// are evaluated by the standard library instead.
+func notModified(req *http.Request, wHeader http.Header) bool {
+	etag := wHeader.Get(ETag)
+	ifNoneMatch := req.Header.Get("If-None-Match")
+	if etag == "" || ifNoneMatch == "" || req.Header.Get("If-Match") != "" || req.Header.Get("If-Unmodified-Since") != "" {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeNotModified writes a 304-not modified response in the same way as the standard library.
+func writeNotModified(w http.ResponseWriter) {
+	h := w.Header()
+	delete(h, ContentType)
+	delete(h, ContentLength)
+	delete(h, ContentEncoding)
+	delete(h, ContentDigest)
+	if h.Get(ETag) != "" {
+		delete(h, LastModified)
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
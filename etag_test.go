@@ -0,0 +1,487 @@
+package servefiles
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rickb777/servefiles/v3/afero2"
+	"github.com/rickb777/servefiles/v3/testdata"
+	"github.com/spf13/afero"
+)
+
+func TestPrecomputeETagsForEmbedFS(t *testing.T) {
+	assets, err := fs.Sub(testdata.TestDataFS, "assets")
+	must(err)
+
+	a, err := NewAssetHandlerIoFS(assets).PrecomputeETags()
+	must(err)
+
+	// style1.css and style1.css.br have the same size but different content
+	etags := make(map[string]bool)
+	for i, encoding := range []string{"xx", "br", "gzip"} {
+		request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+		request.Header.Set("Accept-Encoding", encoding)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		etag := strings.TrimPrefix(w.Header().Get("ETag"), "W/")
+		isEqual(t, etags[etag], false, i)
+		etags[etag] = true
+	}
+
+	// the precomputed ETag is honoured for conditional requests
+	request, _ := http.NewRequest("GET", "/css/style2.css", nil)
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, request)
+	etag := w.Header().Get("ETag")
+	isEqual(t, strings.HasPrefix(etag, `"0-`), false, 0)
+
+	request, _ = http.NewRequest("GET", "/css/style2.css", nil)
+	request.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	a.ServeHTTP(w, request)
+	isEqual(t, w.Code, http.StatusNotModified, 0)
+}
+
+func TestEtagForEmbedFSWithoutPrecompute(t *testing.T) {
+	assets, err := fs.Sub(testdata.TestDataFS, "assets")
+	must(err)
+
+	a := NewAssetHandlerIoFS(assets)
+
+	// style1.css and style1.css.br have the same size and a zero ModTime, but different content
+	etag1 := a.etag("/css/style1.css", mustStatFS(assets, "css/style1.css"))
+	etag2 := a.etag("/css/style1.css.br", mustStatFS(assets, "css/style1.css.br"))
+
+	isNotEqual(t, etag1, etag2, 0)
+	isEqual(t, etag1, a.etag("/css/style1.css", mustStatFS(assets, "css/style1.css")), 0)
+
+	// files with a ModTime are unaffected
+	fi := &memFile{content: []byte("foo"), modTime: time.Unix(1000, 0)}
+	isEqual(t, a.etag("/foo", fi), calculateEtag(fi), 0)
+}
+
+func mustStatFS(fsys fs.FS, name string) fs.FileInfo {
+	fi, err := fs.Stat(fsys, name)
+	must(err)
+	return fi
+}
+
+func TestServeHTTP304WithoutOpeningFile(t *testing.T) {
+	cfs := &countingFS{fs: os.DirFS("assets")}
+	// the original Last-Modified is set before the conditional request is checked
+	a, err := NewAssetHandlerIoFS(cfs).WithMaxAge(time.Hour).WithOriginalLastModified().PrecomputeETags()
+	must(err)
+
+	cases := []struct {
+		encoding string
+		code     int
+		opens    int32
+	}{
+		{encoding: "xx", code: 200, opens: 1},
+		{encoding: "gzip", code: 200, opens: 1},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		w := httptest.NewRecorder()
+		cfs.opens.Store(0)
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, cfs.opens.Load(), test.opens, i)
+		etag := w.Header().Get("ETag")
+
+		// now the same request again, conditionally
+		request.Header.Set("If-None-Match", etag)
+		w = httptest.NewRecorder()
+		cfs.opens.Store(0)
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusNotModified, i)
+		isEqual(t, cfs.opens.Load(), int32(0), i)
+		isEqual(t, w.Header().Get("ETag"), etag, i)
+		// as in the standard library, Last-Modified is redundant when there is an ETag
+		isEqual(t, w.Header().Get("Last-Modified"), "", i)
+		isEqual(t, w.Header().Get("Cache-Control"), "public, max-age=3600", i)
+		isEqual(t, w.Header().Get("Content-Type"), "", i)
+		isEqual(t, w.Body.Len(), 0, i)
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	cases := []struct {
+		etag, ifNoneMatch, ifMatch string
+		expected                   bool
+	}{
+		{etag: `"abc"`, ifNoneMatch: `"abc"`, expected: true},
+		{etag: `W/"abc"`, ifNoneMatch: `"abc"`, expected: true},
+		{etag: `"abc"`, ifNoneMatch: `"x", W/"abc"`, expected: true},
+		{etag: `"abc"`, ifNoneMatch: `*`, expected: true},
+		{etag: `"abc"`, ifNoneMatch: `"x"`, expected: false},
+		{etag: `"abc"`, ifNoneMatch: ``, expected: false},
+		{etag: ``, ifNoneMatch: `"abc"`, expected: false},
+		{etag: `"abc"`, ifNoneMatch: `"abc"`, ifMatch: `"abc"`, expected: false},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", "/", nil)
+		if test.ifNoneMatch != "" {
+			request.Header.Set("If-None-Match", test.ifNoneMatch)
+		}
+		if test.ifMatch != "" {
+			request.Header.Set("If-Match", test.ifMatch)
+		}
+		wHeader := newHeader()
+		if test.etag != "" {
+			wHeader.Set(ETag, test.etag)
+		}
+
+		isEqual(t, notModified(request, wHeader), test.expected, i)
+	}
+}
+
+func Benchmark304WithPrecomputedETags(b *testing.B) {
+	plain := NewAssetHandler("./assets/").WithMaxAge(time.Hour)
+	precomputed, err := plain.PrecomputeETags()
+	must(err)
+
+	for _, a := range []*Assets{plain, precomputed} {
+		request, _ := http.NewRequest("GET", "/css/style2.css", nil)
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, request)
+		request.Header.Set("If-None-Match", w.Header().Get("ETag"))
+
+		b.Run(fmt.Sprintf("precomputed=%v", a.etags != nil), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				w := httptest.NewRecorder()
+				a.ServeHTTP(w, request)
+				if w.Code != http.StatusNotModified {
+					b.Fatalf("Expected 304 but got %d", w.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestCompressedContentETags(t *testing.T) {
+	first := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	second := time.Date(2024, 6, 7, 8, 9, 10, 0, time.UTC)
+
+	cases := []struct {
+		contentETags bool
+		same         bool
+	}{
+		{contentETags: true, same: true},
+		{contentETags: false, same: false},
+	}
+
+	for i, test := range cases {
+		mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+		afero.WriteFile(mfs, "/js/app.js", []byte("function app() {}\n"), 0644)
+		afero.WriteFile(mfs, "/js/app.js.gz", []byte("deterministic gzip output"), 0644)
+
+		a := NewAssetHandlerFS(mfs)
+		if test.contentETags {
+			a = a.WithCompressedContentETags()
+		}
+
+		var etags []string
+		for _, modTime := range []time.Time{first, second} {
+			// simulates a deterministic rebuild
+			must(mfs.Chtimes("/js/app.js.gz", modTime, modTime))
+
+			request, _ := http.NewRequest("GET", "/js/app.js", nil)
+			request.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+
+			a.ServeHTTP(w, request)
+
+			isEqual(t, w.Code, http.StatusOK, i)
+			isEqual(t, w.Header().Get("Content-Encoding"), "gzip", i)
+			isEqual(t, strings.HasPrefix(w.Header().Get("ETag"), `W/"`), true, i)
+			etags = append(etags, w.Header().Get("ETag"))
+		}
+
+		isEqual(t, etags[0] == etags[1], test.same, i)
+	}
+}
+
+func TestHybridETag(t *testing.T) {
+	first := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	second := time.Date(2024, 6, 7, 8, 9, 10, 0, time.UTC)
+
+	cases := []struct {
+		path      string
+		threshold int64
+		same      bool
+	}{
+		{path: "/small.js", threshold: 100, same: true},
+		{path: "/large.js", threshold: 100, same: false},
+		{path: "/small.js", threshold: 0, same: false},
+	}
+
+	for i, test := range cases {
+		mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+		afero.WriteFile(mfs, "/small.js", []byte("function small() {}\n"), 0644)
+		afero.WriteFile(mfs, "/large.js", []byte(strings.Repeat("function large() {}\n", 10)), 0644)
+
+		a := NewAssetHandlerFS(mfs).WithHybridETag(test.threshold)
+
+		var etags []string
+		for _, modTime := range []time.Time{first, second} {
+			// simulates redeployment of an unaltered file
+			must(mfs.Chtimes(test.path, modTime, modTime))
+
+			request, _ := http.NewRequest("GET", test.path, nil)
+			w := httptest.NewRecorder()
+
+			a.ServeHTTP(w, request)
+
+			isEqual(t, w.Code, http.StatusOK, i)
+			etags = append(etags, w.Header().Get("ETag"))
+		}
+
+		isEqual(t, etags[0] == etags[1], test.same, i)
+		isEqual(t, strings.HasPrefix(etags[0], `"`), true, i)
+	}
+}
+
+func TestEncodingInETag(t *testing.T) {
+	cases := []struct {
+		encodingInETag bool
+		gzipSuffix     string
+		brSuffix       string
+	}{
+		{encodingInETag: true, gzipSuffix: `-gzip"`, brSuffix: `-br"`},
+		{encodingInETag: false, gzipSuffix: `"`, brSuffix: `"`},
+	}
+
+	for i, test := range cases {
+		a := NewAssetHandler("./assets/")
+		if test.encodingInETag {
+			a = a.WithEncodingInETag()
+		}
+
+		etags := make(map[string]string)
+		for _, encoding := range []string{"xx", "gzip", "br"} {
+			request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+			request.Header.Set("Accept-Encoding", encoding)
+			w := httptest.NewRecorder()
+
+			a.ServeHTTP(w, request)
+
+			isEqual(t, w.Code, http.StatusOK, i)
+			etags[encoding] = w.Header().Get("ETag")
+		}
+
+		isEqual(t, etags["xx"], etagFor("assets/css/style1.css"), i)
+		isEqual(t, strings.HasSuffix(etags["gzip"], test.gzipSuffix), true, i)
+		isEqual(t, strings.HasSuffix(etags["br"], test.brSuffix), true, i)
+		isNotEqual(t, etags["gzip"], etags["xx"], i)
+		isNotEqual(t, etags["gzip"], "W/"+etags["xx"], i)
+		isNotEqual(t, etags["gzip"], etags["br"], i)
+	}
+}
+
+func TestIfNoneMatchTakesPrecedenceOverIfModifiedSince(t *testing.T) {
+	past := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+	future := time.Now().Add(24 * time.Hour).UTC().Format(http.TimeFormat)
+
+	preloaded, err := NewAssetHandler("./assets/").PreloadCompressed([]string{"css/style1.css"})
+	must(err)
+
+	handlers := []*Assets{
+		NewAssetHandler("./assets/"),
+		NewAssetHandler("./assets/").WithOriginalLastModified(),
+		preloaded,
+	}
+
+	cases := []struct {
+		encoding, ifNoneMatch, ifModifiedSince string
+		code                                   int
+	}{
+		{encoding: "xx", ifNoneMatch: "match", ifModifiedSince: past, code: 304},
+		{encoding: "xx", ifNoneMatch: "match", ifModifiedSince: future, code: 304},
+		{encoding: "xx", ifNoneMatch: `"other"`, ifModifiedSince: future, code: 200},
+		{encoding: "xx", ifNoneMatch: `"other"`, ifModifiedSince: past, code: 200},
+		{encoding: "xx", ifModifiedSince: future, code: 304},
+		{encoding: "xx", ifModifiedSince: past, code: 200},
+		{encoding: "gzip", ifNoneMatch: "match", ifModifiedSince: past, code: 304},
+		{encoding: "gzip", ifNoneMatch: "match", ifModifiedSince: future, code: 304},
+		{encoding: "gzip", ifNoneMatch: `"other"`, ifModifiedSince: future, code: 200},
+		{encoding: "gzip", ifNoneMatch: `"other"`, ifModifiedSince: past, code: 200},
+		{encoding: "gzip", ifModifiedSince: future, code: 304},
+		{encoding: "gzip", ifModifiedSince: past, code: 200},
+	}
+
+	for h, a := range handlers {
+		for j, test := range cases {
+			hint := fmt.Sprintf("%d/%d", h, j)
+
+			// the first request discovers the validators
+			request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+			request.Header.Set("Accept-Encoding", test.encoding)
+			w := httptest.NewRecorder()
+			a.ServeHTTP(w, request)
+			isEqual(t, w.Code, http.StatusOK, hint)
+			etag := w.Header().Get("ETag")
+			isNotEqual(t, w.Header().Get("Last-Modified"), "", hint)
+
+			request, _ = http.NewRequest("GET", "/css/style1.css", nil)
+			request.Header.Set("Accept-Encoding", test.encoding)
+			if test.ifNoneMatch == "match" {
+				request.Header.Set("If-None-Match", etag)
+			} else if test.ifNoneMatch != "" {
+				request.Header.Set("If-None-Match", test.ifNoneMatch)
+			}
+			request.Header.Set("If-Modified-Since", test.ifModifiedSince)
+			w = httptest.NewRecorder()
+
+			a.ServeHTTP(w, request)
+
+			isEqual(t, w.Code, test.code, hint)
+			if test.code == 304 {
+				isEqual(t, w.Body.Len(), 0, hint)
+				isEqual(t, w.Header().Get("ETag"), etag, hint)
+			}
+		}
+	}
+}
+
+func TestIfNoneMatchUsesWeakComparison(t *testing.T) {
+	preloaded, err := NewAssetHandler("./assets/").PreloadCompressed([]string{"css/style1.css"})
+	must(err)
+	precomputed, err := NewAssetHandler("./assets/").PrecomputeETags()
+	must(err)
+
+	handlers := []*Assets{
+		NewAssetHandler("./assets/"),
+		preloaded,
+		precomputed,
+	}
+
+	// an intermediary that alters the byte stream may weaken a strong ETag, or the client may
+	// have cached a compressed variant whose ETag is then sent without its weak prefix
+	cases := []struct {
+		encoding string
+		alter    func(string) string
+	}{
+		{encoding: "xx", alter: func(etag string) string { return "W/" + etag }},
+		{encoding: "xx", alter: func(etag string) string { return `"other", W/` + etag }},
+		{encoding: "gzip", alter: func(etag string) string { return strings.TrimPrefix(etag, "W/") }},
+	}
+
+	for h, a := range handlers {
+		for j, test := range cases {
+			hint := fmt.Sprintf("%d/%d", h, j)
+
+			request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+			request.Header.Set("Accept-Encoding", test.encoding)
+			w := httptest.NewRecorder()
+			a.ServeHTTP(w, request)
+			isEqual(t, w.Code, http.StatusOK, hint)
+			etag := w.Header().Get("ETag")
+
+			request, _ = http.NewRequest("GET", "/css/style1.css", nil)
+			request.Header.Set("Accept-Encoding", test.encoding)
+			request.Header.Set("If-None-Match", test.alter(etag))
+			w = httptest.NewRecorder()
+
+			a.ServeHTTP(w, request)
+
+			isEqual(t, w.Code, http.StatusNotModified, hint)
+			isEqual(t, w.Header().Get("ETag"), etag, hint)
+		}
+	}
+}
+
+func TestCompositeETag(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/atlas/tiles.json", []byte(`{"tiles":["a.png","b.png"]}`), 0644)
+	afero.WriteFile(mfs, "/atlas/tiles.json.gz", []byte("gzipped"), 0644)
+	afero.WriteFile(mfs, "/atlas/a.png", []byte("a"), 0644)
+	afero.WriteFile(mfs, "/atlas/b.png", []byte("b"), 0644)
+	afero.WriteFile(mfs, "/atlas/other.json", []byte("{}"), 0644)
+
+	a := NewAssetHandlerFS(mfs).WithCompositeETag("atlas/tiles.json", "atlas/a.png", "/atlas/b.png")
+
+	etagOf := func(path, encoding string) string {
+		request, _ := http.NewRequest("GET", path, nil)
+		request.Header.Set("Accept-Encoding", encoding)
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, request)
+		isEqual(t, w.Code, http.StatusOK, path)
+		return w.Header().Get("ETag")
+	}
+
+	identity := etagOf("/atlas/tiles.json", "xx")
+	compressed := etagOf("/atlas/tiles.json", "gzip")
+	other := etagOf("/atlas/other.json", "xx")
+	image := etagOf("/atlas/b.png", "xx")
+
+	isEqual(t, strings.HasPrefix(identity, `"`), true, 0)
+	isEqual(t, strings.HasPrefix(compressed, `W/"`), true, 0)
+
+	// altering a referenced image alters the manifest's ETags
+	later := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	must(mfs.Chtimes("/atlas/b.png", later, later))
+
+	isNotEqual(t, etagOf("/atlas/tiles.json", "xx"), identity, 1)
+	isNotEqual(t, etagOf("/atlas/tiles.json", "gzip"), compressed, 1)
+	isNotEqual(t, etagOf("/atlas/b.png", "xx"), image, 1)
+	isEqual(t, etagOf("/atlas/other.json", "xx"), other, 1)
+
+	// removing a referenced image also alters the manifest's ETag
+	altered := etagOf("/atlas/tiles.json", "xx")
+	must(mfs.Remove("/atlas/a.png"))
+	isNotEqual(t, etagOf("/atlas/tiles.json", "xx"), altered, 2)
+
+	// the composite ETag is stable
+	isEqual(t, etagOf("/atlas/tiles.json", "xx"), etagOf("/atlas/tiles.json", "xx"), 3)
+}
+
+func TestCompositeLastModified(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/atlas/tiles.json", []byte(`{"tiles":["a.png"]}`), 0644)
+	afero.WriteFile(mfs, "/atlas/tiles.json.gz", []byte("gzipped"), 0644)
+	afero.WriteFile(mfs, "/atlas/a.png", []byte("a"), 0644)
+
+	earlier := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	later := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	must(mfs.Chtimes("/atlas/tiles.json", earlier, earlier))
+	must(mfs.Chtimes("/atlas/tiles.json.gz", earlier, earlier))
+	must(mfs.Chtimes("/atlas/a.png", later, later))
+
+	a := NewAssetHandlerFS(mfs).WithCompositeETag("/atlas/tiles.json", "/atlas/a.png")
+
+	for i, encoding := range []string{"xx", "gzip"} {
+		request, _ := http.NewRequest("GET", "/atlas/tiles.json", nil)
+		request.Header.Set("Accept-Encoding", encoding)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Last-Modified"), later.Format(http.TimeFormat), i)
+
+		// a client that has the manifest from before the image changed must fetch it again
+		request.Header.Set("If-Modified-Since", earlier.Add(time.Hour).Format(http.TimeFormat))
+		w = httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+	}
+}
@@ -0,0 +1,38 @@
+//go:build unix
+
+package servefiles
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestServeHTTPRefusesFifo(t *testing.T) {
+	dir := t.TempDir()
+	must(syscall.Mkfifo(filepath.Join(dir, "pipe.js"), 0644))
+	must(os.WriteFile(filepath.Join(dir, "app.js"), []byte("function app() {}\n"), 0644))
+
+	cases := []struct {
+		path, encoding string
+		code           int
+	}{
+		{path: "/pipe.js", encoding: "xx", code: 404},
+		{path: "/pipe.js", encoding: "gzip", code: 404},
+		{path: "/app.js", encoding: "xx", code: 200},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.path, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		a := NewAssetHandler(dir)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+	}
+}
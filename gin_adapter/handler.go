@@ -25,6 +25,7 @@ package gin_adapter
 import (
 	"io/fs"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -82,10 +83,39 @@ func (a GinAssets) WithNotFound(notFound http.Handler) *GinAssets {
 // HandlerFunc gets the asset handler as a Gin handler. The handler is
 // registered using a catch-all path such as "/files/*filepath". The name
 // of the catch-all parameter is passed in here (for example "filepath").
+//
+// Only the catch-all parameter is seen by the asset handler, so all the fixed
+// segments of the path are stripped automatically, however many there are.
+// StripOff is only needed to remove further segments that follow, such as a
+// version number.
+//
+// A request for the mount point itself (e.g. "/files/") is a request for the
+// root directory, so it is served the root index.html or a directory listing,
+// or 404-not found if DisableDirListing is set and there is no index.
 func (a *GinAssets) HandlerFunc(paramName string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		req := c.Request
 		req.URL.Path = c.Param(paramName)
+		if req.URL.Path == "" {
+			// the bare mount point is the root directory
+			req.URL.Path = "/"
+		}
 		(*servefiles.Assets)(a).ServeHTTP(c.Writer, c.Request)
 	}
 }
+
+// Register registers the asset handler with a Gin engine or router group using
+// the specified path to handle GET and HEAD requests.
+//
+// The handler is registered using a catch-all path such as "/files/*filepath".
+// The name of the catch-all parameter is taken from the path, so it need not be
+// specified separately as it is for HandlerFunc.
+func (a *GinAssets) Register(r gin.IRoutes, path string) {
+	i := strings.LastIndex(path, "/*")
+	if i < 0 || strings.Contains(path[i+2:], "/") || i+2 == len(path) {
+		panic(path + ": path must end with a catch-all parameter such as /*filepath")
+	}
+	h := a.HandlerFunc(path[i+2:])
+	r.GET(path, h)
+	r.HEAD(path, h)
+}
@@ -168,3 +168,77 @@ func TestHandlerFunc_with_EmbedFS(t *testing.T) {
 
 	g.Expect(w.Code).To(Equal(404))
 }
+
+func TestRegister_multi_segment_prefix_without_StripOff(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	sub, err := fs.Sub(testdata.TestDataFS, "assets")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	h := gin_adapter.NewAssetHandlerIoFS(sub)
+
+	router := gin.New()
+	h.Register(router, "/static/app/assets/*filepath")
+
+	r, _ := http.NewRequest(http.MethodGet, "http://localhost/static/app/assets/js/script1.js", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	g.Expect(w.Code).To(Equal(200))
+	g.Expect(w.Header().Get("Content-Type")).To(Equal(javascriptMimeType))
+	g.Expect(w.Body.Len()).To(Equal(19))
+
+	r, _ = http.NewRequest(http.MethodHead, "http://localhost/static/app/assets/css/style2.css", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	g.Expect(w.Code).To(Equal(200))
+	g.Expect(w.Body.Len()).To(Equal(0))
+}
+
+func TestRegister_rejects_path_without_catch_all(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	h := gin_adapter.NewAssetHandler("../testdata/assets")
+
+	for _, p := range []string{"/files", "/files/*", "/files/*x/y"} {
+		g.Expect(func() { h.Register(gin.New(), p) }).To(Panic(), p)
+	}
+}
+
+func TestRegister_mount_root(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	withIndex, err := fs.Sub(testdata.TestDataFS, "assets")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	withoutIndex := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(withoutIndex, "/a.txt", []byte("a"), 0644)
+
+	unlisted := gin_adapter.NewAssetHandlerFS(withoutIndex)
+	unlisted.DisableDirListing = true
+
+	cases := []struct {
+		h    *gin_adapter.GinAssets
+		url  string
+		code int
+		body string
+	}{
+		{h: gin_adapter.NewAssetHandlerIoFS(withIndex), url: "http://localhost/files/", code: 200, body: "index page"},
+		{h: gin_adapter.NewAssetHandlerFS(withoutIndex), url: "http://localhost/files/", code: 200, body: "a.txt"},
+		{h: unlisted, url: "http://localhost/files/", code: 404},
+	}
+
+	for _, test := range cases {
+		router := gin.New()
+		test.h.Register(router, "/files/*filepath")
+
+		r, _ := http.NewRequest(http.MethodGet, test.url, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		g.Expect(w.Code).To(Equal(test.code), test.url)
+		g.Expect(w.Header().Get("Location")).To(Equal(""), test.url)
+		g.Expect(w.Body.String()).To(ContainSubstring(test.body), test.url)
+	}
+}
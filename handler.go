@@ -1,64 +1,188 @@
 package servefiles
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"math/rand/v2"
 	"mime"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/rickb777/path"
 )
 
 const (
-	AcceptEncoding      = "Accept-Encoding"
-	CacheControl        = "Cache-Control"
-	ContentEncoding     = "Content-Encoding"
-	ContentType         = "Content-Type"
-	ETag                = "ETag"
-	Expires             = "Expires"
-	RetryAfter          = "Retry-After"
-	Vary                = "Vary"
-	xContentTypeOptions = "X-Content-Type-Options"
+	AcceptEncoding                = "Accept-Encoding"
+	AcceptRanges                  = "Accept-Ranges"
+	AccessControlAllowCredentials = "Access-Control-Allow-Credentials"
+	AccessControlAllowHeaders     = "Access-Control-Allow-Headers"
+	AccessControlAllowMethods     = "Access-Control-Allow-Methods"
+	AccessControlAllowOrigin      = "Access-Control-Allow-Origin"
+	AccessControlRequestHeaders   = "Access-Control-Request-Headers"
+	AccessControlRequestMethod    = "Access-Control-Request-Method"
+	Allow                         = "Allow"
+	AvailableDictionary           = "Available-Dictionary"
+	CacheControl                  = "Cache-Control"
+	ClearSiteData                 = "Clear-Site-Data"
+	ContentDigest                 = "Content-Digest"
+	ContentDisposition            = "Content-Disposition"
+	ContentDPR                    = "Content-DPR"
+	ContentEncoding               = "Content-Encoding"
+	ContentLength                 = "Content-Length"
+	ContentSecurityPolicy         = "Content-Security-Policy"
+	ContentType                   = "Content-Type"
+	CrossOriginEmbedderPolicy     = "Cross-Origin-Embedder-Policy"
+	CrossOriginOpenerPolicy       = "Cross-Origin-Opener-Policy"
+	CrossOriginResourcePolicy     = "Cross-Origin-Resource-Policy"
+	Deprecation                   = "Deprecation"
+	DPR                           = "DPR"
+	ETag                          = "ETag"
+	Expires                       = "Expires"
+	LastModified                  = "Last-Modified"
+	Link                          = "Link"
+	Location                      = "Location"
+	Origin                        = "Origin"
+	PermissionsPolicy             = "Permissions-Policy"
+	Range                         = "Range"
+	ReportingEndpoints            = "Reporting-Endpoints"
+	RetryAfter                    = "Retry-After"
+	SecCHDPR                      = "Sec-CH-DPR"
+	Sunset                        = "Sunset"
+	Vary                          = "Vary"
+	XBuild                        = "X-Build"
+	XEncodingBucket               = "X-Encoding-Bucket"
+	XForwardedHost                = "X-Forwarded-Host"
+	XForwardedProto               = "X-Forwarded-Proto"
+	XIfNoneBuild                  = "X-If-None-Build"
+	XResolvedPath                 = "X-Resolved-Path"
+	xContentTypeOptions           = "X-Content-Type-Options"
 )
 
+// allowedMethods is the value of the Allow header.
+const allowedMethods = "GET, HEAD, OPTIONS"
+
+type compressedVariant struct{ encoding, ext string }
+
+// compressedVariants lists the pre-compressed sibling files that are looked for, in order of preference.
+var compressedVariants = []compressedVariant{
+	{encoding: "br", ext: ".br"},
+	{encoding: "gzip", ext: ".gz"},
+}
+
 //-------------------------------------------------------------------------------------------------
 
 // Calculate the 'Expires' value using an approximation that reduces unimportant re-calculation.
 // We don't need to do this accurately because the 'Cache-Control' maxAge value takes precedence
 // anyway. So the value is cached and shared between requests for a short while.
 func (a *Assets) expires() string {
-	if a.expiryElasticity == 0 {
-		// lazy initialisation
-		a.expiryElasticity = 1 + a.MaxAge/100
+	maxAge := a.effectiveMaxAge()
+	now := time.Now().UTC()
+
+	// the cached value is immutable, so concurrent requests need no locking
+	if a.expiry == nil {
+		// not made by a constructor, so there is no cache
+		return now.Add(maxAge).Format(time.RFC1123)
 	}
 
-	now := time.Now().UTC()
-	unix := now.Unix()
+	if cached := a.expiry.Load(); cached != nil && cached.maxAge == maxAge && now.Before(cached.refreshAt) {
+		return cached.formatted
+	}
+
+	elasticity := 1 + maxAge/100
+	later := now.Add(maxAge + elasticity) // add elasticity to avoid negative expiry
+
+	// cache the formatted string for at least one second to avoid repeated formatting
+	cached := &cachedExpiry{
+		maxAge:    maxAge,
+		refreshAt: time.Unix(now.Unix()+int64(elasticity/time.Second)+1, 0),
+		formatted: later.Format(time.RFC1123),
+	}
+	a.expiry.Store(cached)
+	return cached.formatted
+}
+
+// cachedExpiry is a formatted Expires value, which is valid until refreshAt for a given max age.
+type cachedExpiry struct {
+	maxAge    time.Duration
+	refreshAt time.Time
+	formatted string
+}
+
+// effectiveMaxAge is the MaxAge, limited by the clamp if there is one.
+func (a *Assets) effectiveMaxAge() time.Duration {
+	return a.clamp(a.MaxAge)
+}
 
-	if unix > a.timestamp {
-		later := now.Add(a.MaxAge + a.expiryElasticity) // add expiryElasticity to avoid negative expiry
+func (a *Assets) clamp(maxAge time.Duration) time.Duration {
+	if a.maxAgeClamp > 0 && maxAge > a.maxAgeClamp {
+		return a.maxAgeClamp
+	}
+	return maxAge
+}
 
-		a.lock.Lock()
-		defer a.lock.Unlock()
+// setCacheHeaders sets the Expires and Cache-Control headers. The precedence is
+//   - the cache bypass header, if present in the request
+//   - the default max age, if set, unless a header rule sets Cache-Control for the resource
+//   - MaxAge
+func (a *Assets) setCacheHeaders(wHeader http.Header, req *http.Request, resource string) {
+	if a.cacheBypassHeader != "" {
+		if _, present := req.Header[a.cacheBypassHeader]; present {
+			wHeader.Set(CacheControl, "no-store")
+			return
+		}
+	}
 
-		// cache the formatted string for one second to avoid repeated formatting
-		// race condition is ignored here, but note the order below
-		a.timestampExpiry = later.Format(time.RFC1123)
-		a.timestamp = unix + int64(a.expiryElasticity)
+	if a.hasDefaultMaxAge {
+		if !a.hasCacheControlRule(resource) {
+			a.setMaxAgeHeaders(wHeader, req, a.clamp(a.defaultMaxAge))
+		}
+		return
+	}
 
-		// ensure that maxAgeS is set
-		if a.maxAgeS == 0 {
-			a.maxAgeS = int(a.MaxAge / time.Second)
+	if a.MaxAge > 0 {
+		if !a.omitExpires(req, a.effectiveMaxAge()) {
+			wHeader.Set(Expires, a.expires())
 		}
+		wHeader.Set(CacheControl, fmt.Sprintf("%s, max-age=%d", a.cacheScope(), int(a.effectiveMaxAge()/time.Second)))
+	} else if a.varyCookie {
+		wHeader.Set(CacheControl, "private")
+	}
+}
+
+// addCacheDirective appends a directive to the Cache-Control header, if there is one.
+func addCacheDirective(wHeader http.Header, directive string) {
+	if cc := wHeader.Get(CacheControl); cc != "" {
+		wHeader.Set(CacheControl, cc+", "+directive)
+	} else {
+		wHeader.Set(CacheControl, directive)
+	}
+}
+
+// cacheScope gets the Cache-Control directive that says which caches may store the response.
+func (a *Assets) cacheScope() string {
+	if a.varyCookie {
+		// personalised content must not be stored in shared caches
+		return "private"
 	}
+	return "public"
+}
 
-	return a.timestampExpiry
+// omitExpires is true for far-future max ages that exceed the Expires threshold, if there is one,
+// and for HTTP/2+ requests if Expires is only wanted for older clients.
+func (a *Assets) omitExpires(req *http.Request, maxAge time.Duration) bool {
+	if a.expiresHTTP1Only && req.ProtoMajor >= 2 {
+		return true
+	}
+	return a.expiresThreshold > 0 && maxAge > a.expiresThreshold
 }
 
 //-------------------------------------------------------------------------------------------------
@@ -76,6 +200,12 @@ func calculateEtag(fi os.FileInfo) string {
 	return fmt.Sprintf(`"%x-%x"`, fi.ModTime().Unix(), fi.Size())
 }
 
+// isBrokenPath is true for errors caused by the path itself, such as a symlink loop, rather than
+// by transient conditions on the server.
+func isBrokenPath(err error) bool {
+	return errors.Is(err, syscall.ELOOP) || errors.Is(err, syscall.ENAMETOOLONG)
+}
+
 func handleSaturatedServer(wHeader http.Header, resource string) fileData {
 	// Possibly the server is under heavy load and ran out of file descriptors
 	backoff := 2 + rand.IntN(4) // 2–6 seconds to prevent a stampede
@@ -83,6 +213,43 @@ func handleSaturatedServer(wHeader http.Header, resource string) fileData {
 	return fileData{resource, ServiceUnavailable, nil}
 }
 
+const htmlMimeType = "text/html; charset=utf-8"
+
+// isHTML decides whether a logical asset path refers to an HTML document. Directory paths are
+// HTML because they are served as an index page or a directory listing.
+func (a *Assets) isHTML(logical string) bool {
+	if logical == "" || strings.HasSuffix(logical, "/") {
+		return true
+	}
+	return strings.HasPrefix(a.contentType(logical), "text/html")
+}
+
+// contentType gets the content type for a file name, from its extension.
+func (a *Assets) contentType(name string) string {
+	ext := filepath.Ext(name)
+	if contentType, exists := a.contentTypes[strings.ToLower(ext)]; exists {
+		return contentType
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// hostname gets the lowercase host name without any port number.
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+func containsControlChar(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < 0x20 {
+			return true
+		}
+	}
+	return false
+}
+
 func removeLeadingSlash(name string) string {
 	if len(name) > 0 && name[0] == '/' {
 		name = name[1:]
@@ -90,6 +257,17 @@ func removeLeadingSlash(name string) string {
 	return name
 }
 
+// segmentCount counts the non-empty segments of a slash-separated path.
+func segmentCount(name string) int {
+	n := 0
+	for _, segment := range strings.Split(name, "/") {
+		if segment != "" {
+			n++
+		}
+	}
+	return n
+}
+
 func removeTrailingSlash(name string) string {
 	last := len(name) - 1
 	if len(name) > 0 && name[last] == '/' {
@@ -98,26 +276,71 @@ func removeTrailingSlash(name string) string {
 	return name
 }
 
-func httpError(w http.ResponseWriter, code code, method string) {
+// httpError is like http.Error but it also sets the Content-Length, which helps proxies and
+// keep-alive connections. HEAD responses have no body and therefore no Content-Length.
+func (a *Assets) httpError(w http.ResponseWriter, code code, method string) {
 	if method == http.MethodHead {
 		w.WriteHeader(int(code))
+	} else if page, exists := a.errorPages[code]; exists {
+		h := w.Header()
+		h.Set(ContentType, page.contentType)
+		h.Set(ContentLength, strconv.Itoa(len(page.body)))
+		h.Set(xContentTypeOptions, "nosniff")
+		w.WriteHeader(int(code))
+		w.Write(page.body)
 	} else {
-		http.Error(w, code.String(), int(code))
+		text, exists := a.errorText[code]
+		if !exists {
+			text = code.String()
+		}
+		body := text + "\n"
+		h := w.Header()
+		h.Set(ContentType, "text/plain; charset=utf-8")
+		h.Set(ContentLength, strconv.Itoa(len(body)))
+		h.Set(xContentTypeOptions, "nosniff")
+		w.WriteHeader(int(code))
+		io.WriteString(w, body)
 	}
 }
 
+// statusError writes an error response that is decided before any resource is chosen, applying
+// the WithCacheByStatus policy as ServeHTTP does for the other responses.
+func (a *Assets) statusError(w http.ResponseWriter, req *http.Request, code code) {
+	a.setStatusCacheHeaders(w.Header(), req, code)
+	a.httpError(w, code, req.Method)
+}
+
 //-------------------------------------------------------------------------------------------------
 
 func (a *Assets) checkResource(resource string, wHeader http.Header) fileData {
-	d, err := fs.Stat(a.fs, removeLeadingSlash(resource))
+	if mf, exists := a.preloaded[resource]; exists {
+		// no filesystem access is needed for preloaded assets
+		if mf == nil {
+			return fileData{"", NotFound, nil}
+		}
+		return a.checkSize(fileData{resource, OK, mf})
+	}
+
+	name := removeLeadingSlash(resource)
+	if name == "" {
+		// the root directory; fs.FS requires "." here
+		name = "."
+	}
+
+	d, err := fs.Stat(a.fs, name)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
 			// gzipped does not exist; original might but this gets checked later
 			return fileData{"", NotFound, nil}
 
 		} else if os.IsPermission(err) {
 			// incorrectly assembled gzipped asset is treated as an error
 			return fileData{resource, Forbidden, nil}
+
+		} else if isBrokenPath(err) {
+			// retrying will never help, so this is not treated as a saturated server
+			Debugf("Assets unreachable %s %v\n", resource, err)
+			return fileData{"", NotFound, nil}
 		}
 
 		return handleSaturatedServer(wHeader, resource)
@@ -128,83 +351,307 @@ func (a *Assets) checkResource(resource string, wHeader http.Header) fileData {
 		return fileData{resource, Directory, nil}
 	}
 
-	return fileData{resource, OK, d}
+	if !d.Mode().IsRegular() {
+		// named pipes, sockets and devices might block or behave strangely if served
+		Debugf("Assets not a regular file %s %v\n", resource, d.Mode())
+		return fileData{"", NotFound, nil}
+	}
+
+	return a.checkSize(fileData{resource, OK, d})
+}
+
+func (a *Assets) checkSize(fd fileData) fileData {
+	if a.maxFileSize > 0 && fd.fi.Size() > a.maxFileSize {
+		// oversized files are treated as if they don't exist
+		Debugf("Assets file too large %s %d\n", fd.resource, fd.fi.Size())
+		return fileData{"", NotFound, nil}
+	}
+	return fd
+}
+
+// listingDisabled decides whether a directory listing may be generated. The rule with the longest
+// matching prefix, if any, overrides DisableDirListing.
+func (a *Assets) listingDisabled(dir string) bool {
+	dir = strings.TrimSuffix("/"+strings.Trim(dir, "/"), "/") + "/"
+	disabled, longest := a.DisableDirListing, -1
+	for _, rule := range a.listingRules {
+		if strings.HasPrefix(dir, rule.prefix) && len(rule.prefix) > longest {
+			disabled, longest = !rule.enabled, len(rule.prefix)
+		}
+	}
+	return disabled
+}
+
+// hasIndex is true if the directory contains an index file, possibly only in compressed form.
+func (a *Assets) hasIndex(dir string) bool {
+	index := dir + "/" + IndexPage
+	if a.checkResource(index, make(http.Header)).code == OK {
+		return true
+	}
+	for _, variant := range compressedVariants {
+		if a.checkResource(index+variant.ext, make(http.Header)).code == OK {
+			return true
+		}
+	}
+	return false
+}
+
+// encodingEnabled is true if the handler looks for compressed variants with the encoding.
+func (a *Assets) encodingEnabled(encoding string) bool {
+	return a.enabledEncodings == nil || a.enabledEncodings.Contains(encoding)
+}
+
+// setCompressedHeaders sets the headers that are the same for every compressed variant.
+func (a *Assets) setCompressedHeaders(wHeader http.Header, resource, typeName, encoding string) {
+	wHeader.Set(ContentType, a.contentType(typeName))
+	// the standard library sometimes overrides the content type via sniffing
+	wHeader.Set(xContentTypeOptions, "nosniff")
+	wHeader.Set(ContentEncoding, encoding)
+	wHeader.Add(Vary, AcceptEncoding)
+	if a.encodingBucket {
+		wHeader.Set(XEncodingBucket, encoding)
+	}
+	if a.noTransform {
+		addCacheDirective(wHeader, "no-transform")
+	}
+	if a.originalLastModified {
+		if fd := a.checkResource(resource, make(http.Header)); fd.code == OK && !fd.fi.ModTime().IsZero() {
+			// ServeHTTP uses this in place of the compressed file's own modification time
+			wHeader.Set(LastModified, fd.fi.ModTime().UTC().Format(http.TimeFormat))
+		}
+	}
+	if a.acceptRanges {
+		// byte ranges of a compressed variant are rarely useful to clients
+		wHeader.Set(AcceptRanges, "none")
+	}
+}
+
+// originalSize gets the size of the original file, or zero if it cannot be found.
+func (a *Assets) originalSize(resource string) int64 {
+	if fd := a.checkResource(resource, make(http.Header)); fd.code == OK {
+		return fd.fi.Size()
+	}
+	return 0
+}
+
+// compressionWorthwhile is true if the compressed size is enough smaller than the original size.
+// Compressed-only assets (i.e. without an original) are always worthwhile.
+func (a *Assets) compressionWorthwhile(originalSize, compressedSize int64) bool {
+	if originalSize == 0 {
+		return true
+	}
+	saving := 1 - float64(compressedSize)/float64(originalSize)
+	return saving >= a.minCompressionRatio
+}
+
+// compressionAllowed decides whether compressed variants may be served for a request.
+func (a *Assets) compressionAllowed(req *http.Request) bool {
+	if a.noCompressionHTTP10 && req.ProtoMajor == 1 && req.ProtoMinor == 0 {
+		// some old HTTP/1.0 intermediaries mishandle Content-Encoding
+		return false
+	}
+	return a.compressionDecider == nil || a.compressionDecider(req)
+}
+
+// variants gets the compressed variants in order of preference for the request.
+func (a *Assets) variants(req *http.Request) []compressedVariant {
+	if a.preferredEncoding == nil {
+		return compressedVariants
+	}
+
+	preferred := a.preferredEncoding(req)
+	for i, variant := range compressedVariants {
+		if variant.encoding == preferred && i > 0 {
+			ordered := []compressedVariant{variant}
+			ordered = append(ordered, compressedVariants[:i]...)
+			return append(ordered, compressedVariants[i+1:]...)
+		}
+	}
+	return compressedVariants
+}
+
+// legalBlock finds the authority that blocked any of the named assets, which might be requested
+// via one of their compressed variants.
+func (a *Assets) legalBlock(names ...string) (string, bool) {
+	for _, name := range names {
+		if authority, blocked := a.legalBlocks[name]; blocked {
+			return authority, true
+		}
+		if ext, isVariant := variantExt(name); isVariant {
+			if authority, blocked := a.legalBlocks[strings.TrimSuffix(name, ext)]; blocked {
+				return authority, true
+			}
+		}
+	}
+	return "", false
 }
 
 //-------------------------------------------------------------------------------------------------
 
 func (a *Assets) chooseResource(wHeader http.Header, req *http.Request, resource string) (string, code) {
 
-	if strings.HasSuffix(resource, "/") {
-		indexPath, indexCode := a.chooseResource(wHeader, req, resource+IndexPage)
-		if indexCode == OK {
-			if strings.HasSuffix(indexPath, "/"+IndexPage) {
-				// needed because http.FileServer causes redirection in this case
-				return resource, indexCode
-			} else {
+	if file, exists := a.aliases[resource]; exists {
+		// aliased paths bypass the normal path logic
+		resource = file
+	}
+
+	trailingSlash := strings.HasSuffix(resource, "/")
+	if trailingSlash {
+		if !a.noIndexResolution {
+			indexPath, indexCode := a.chooseResource(wHeader, req, resource+IndexPage)
+			if indexCode == OK {
+				// ServeHTTP serves the index file directly; see serveFile
+				return indexPath, indexCode
+			} else if (a.listingDisabled(resource) && !a.redirectTrailingSlash) || (indexCode >= 400 && indexCode != NotFound) {
+				// an index that exists but cannot be served (e.g. forbidden) must not be replaced
+				// by a listing, which might expose other files
+				delete(wHeader, Expires)
+				delete(wHeader, CacheControl)
 				return indexPath, indexCode
 			}
-		} else if a.DisableDirListing {
-			delete(wHeader, Expires)
-			delete(wHeader, CacheControl)
-			return indexPath, indexCode
 		}
 		resource = removeTrailingSlash(resource)
 	}
 
-	if a.MaxAge > 0 {
-		wHeader.Set(Expires, a.expires())
-		wHeader.Set(CacheControl, fmt.Sprintf("public, max-age=%d", a.maxAgeS))
+	a.setCacheHeaders(wHeader, req, resource)
+
+	// the content type always depends on the requested name, even if the file has another extension
+	typeName := resource
+	if fsExt, exists := a.extensionRewrites[strings.ToLower(filepath.Ext(resource))]; exists {
+		resource = strings.TrimSuffix(resource, filepath.Ext(resource)) + fsExt
+	}
+
+	if a.dprConvention != "" {
+		resource = a.dprVariant(wHeader, req, resource)
+	}
+
+	if a.debugHeader != "" {
+		resource = a.debugVariant(wHeader, req, resource)
 	}
 
-	acceptEncoding := commaSeparatedList(req.Header.Get(AcceptEncoding))
+	if authority, blocked := a.legalBlock(typeName, resource); blocked {
+		// see RFC7725
+		if authority != "" {
+			wHeader.Set(Link, "<"+authority+`>; rel="blocked-by"`)
+		}
+		delete(wHeader, Expires)
+		delete(wHeader, CacheControl)
+		return "", UnavailableForLegalReasons
+	}
 
-	if acceptEncoding.Contains("br") {
-		brotli := resource + ".br"
+	// the header may be split across several lines, which is equivalent to a single comma-separated line
+	acceptEncoding := commaSeparatedList(strings.Join(req.Header.Values(AcceptEncoding), ","))
 
-		fdbr := a.checkResource(brotli, wHeader)
+	// directories never have compressed variants
+	compressionAllowed := !trailingSlash && a.compressionAllowed(req) && !a.altersHTML(typeName)
 
-		if fdbr.code == OK {
-			ext := filepath.Ext(resource)
-			wHeader.Set(ContentType, mime.TypeByExtension(ext))
-			// the standard library sometimes overrides the content type via sniffing
-			wHeader.Set(xContentTypeOptions, "nosniff")
-			wHeader.Set(ContentEncoding, "br")
-			wHeader.Add(Vary, AcceptEncoding)
-			// weak etag because the representation is not the original file but a compressed variant
-			wHeader.Set(ETag, "W/"+calculateEtag(fdbr.fi))
-			return brotli, OK
+	if compressionAllowed && a.zstdDictionary != nil {
+		if compressed, found := a.dictionaryVariant(wHeader, req, resource, typeName, acceptEncoding); found {
+			return compressed, OK
 		}
 	}
 
-	if acceptEncoding.Contains("gzip") {
-		gzipped := resource + ".gz"
+	originalSize := int64(-1) // unknown until needed
+
+	// a variant is only served if its encoding is listed by the client; otherwise the original
+	// file is served, even if only some other compressed variant exists
+	for _, variant := range a.variants(req) {
+		if compressionAllowed && acceptEncoding.Contains(variant.encoding) && a.encodingEnabled(variant.encoding) {
+			compressed := resource + variant.ext
+
+			// only a regular file is served; e.g. a directory with this name is ignored
+			fdc := a.checkResource(compressed, wHeader)
 
-		fdgz := a.checkResource(gzipped, wHeader)
+			if fdc.code == OK && a.minCompressionRatio > 0 {
+				if originalSize < 0 {
+					originalSize = a.originalSize(resource)
+				}
+				if !a.compressionWorthwhile(originalSize, fdc.fi.Size()) {
+					continue
+				}
+			}
 
-		if fdgz.code == OK {
-			ext := filepath.Ext(resource)
-			wHeader.Set(ContentType, mime.TypeByExtension(ext))
-			// the standard library sometimes overrides the content type via sniffing
-			wHeader.Set(xContentTypeOptions, "nosniff")
-			wHeader.Set(ContentEncoding, "gzip")
-			wHeader.Add(Vary, AcceptEncoding)
-			// weak etag because the representation is not the original file but a compressed variant
-			wHeader.Set(ETag, "W/"+calculateEtag(fdgz.fi))
-			return gzipped, OK
+			if fdc.code == OK {
+				a.setCompressedHeaders(wHeader, resource, typeName, variant.encoding)
+				// weak etag because the representation is not the original file but a compressed variant
+				wHeader.Set(ETag, "W/"+a.compositeEtag(wHeader, resource, a.compressedEtag(compressed, variant.encoding, fdc.fi), fdc.fi.ModTime()))
+				wHeader.Set(ContentLength, strconv.FormatInt(fdc.fi.Size(), 10))
+				a.setContentDigest(wHeader, req, compressed, fdc.fi)
+				return compressed, OK
+			}
 		}
 	}
 
 	// no intervention; the file will be served normally by the standard api
 	fd := a.checkResource(resource, wHeader)
+	for retry := 0; fd.code == NotFound && retry < a.notFoundRetries; retry++ {
+		// the file might be in the middle of being replaced by an atomic rename
+		time.Sleep(a.notFoundRetryDelay)
+		fd = a.checkResource(resource, wHeader)
+	}
+
+	if trailingSlash {
+		if fd.code == OK {
+			// a file was requested as if it were a directory
+			if a.redirectTrailingSlash {
+				return resource, MovedPermanently
+			}
+			return "", NotFound
+		} else if fd.code == Directory && a.listingDisabled(resource) {
+			delete(wHeader, Expires)
+			delete(wHeader, CacheControl)
+			return "", NotFound
+		}
+	}
+
+	if fd.code == Directory && !trailingSlash && a.indexRedirect && a.hasIndex(resource) {
+		// relative links in the index page need the trailing slash
+		return resource, MovedPermanently
+	}
+
+	if fd.code == Directory && !trailingSlash && a.listingDisabled(resource) {
+		delete(wHeader, Expires)
+		delete(wHeader, CacheControl)
+		if !a.noIndexResolution && a.hasIndex(resource) {
+			// the index page is served for the path with the trailing slash; nothing else is
+			return resource, MovedPermanently
+		}
+		return "", NotFound
+	}
 
 	if fd.code == Directory {
 		// add trailing slash because we stripped it above and it allows the
 		// standard file handler to create a directory listing
 		fd.resource += "/"
+		wHeader.Set(ContentType, htmlMimeType)
 	} else if fd.code < 300 {
+		if contentType, exists := a.contentTypes[strings.ToLower(filepath.Ext(typeName))]; exists {
+			// otherwise the standard library chooses the content type
+			wHeader.Set(ContentType, contentType)
+		} else if typeName != resource && a.contentType(typeName) != "" {
+			// otherwise the standard library would use the file's extension
+			wHeader.Set(ContentType, a.contentType(typeName))
+		}
+		if a.encodingBucket {
+			wHeader.Set(XEncodingBucket, "identity")
+		}
 		// strong etag because the representation is the original file
-		wHeader.Set(ETag, calculateEtag(fd.fi))
+		etag := a.compositeEtag(wHeader, fd.resource, a.etag(fd.resource, fd.fi), fd.fi.ModTime())
+		if a.altersHTML(typeName) {
+			etag = "W/" + a.alteredEtag(etag)
+		} else if a.weakETagsOnly {
+			etag = "W/" + etag
+		}
+		wHeader.Set(ETag, etag)
+		if a.altersHTML(typeName) {
+			// neither byte ranges nor the digest of the file apply to the altered document
+			wHeader.Set(AcceptRanges, "none")
+		} else {
+			a.setContentDigest(wHeader, req, fd.resource, fd.fi)
+			if a.acceptRanges {
+				wHeader.Set(AcceptRanges, "bytes")
+			}
+		}
 	}
 
 	return fd.resource, fd.code
@@ -218,24 +665,178 @@ func (a *Assets) chooseResource(wHeader http.Header, req *http.Request, resource
 // all the standard logic paths implemented there, including conditional
 // requests and content negotiation.
 func (a *Assets) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if a.slowServeThreshold > 0 {
+		// the arguments are evaluated now, before the path can be altered
+		defer a.logSlowServe(req.Method, req.URL.Path, time.Now())
+	}
+
+	if a.corsOrigins != nil && isPreflight(req) {
+		a.servePreflight(w, req)
+		return
+	}
+
+	if req.Method == http.MethodOptions {
+		// a bare OPTIONS request simply reports the allowed methods
+		w.Header().Set(Allow, allowedMethods)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
 	if req.Method != http.MethodHead && req.Method != http.MethodGet {
 		// use the provided not-found handler
 		Debugf("Assets ServeHTTP (method not allowed) %s %s R:%s W:%s\n", req.Method, req.URL.Path,
 			headerStringer(req.Header), headerStringer(w.Header()))
-		if a.MethodNotAllowed != nil {
+		if a.MethodNotAllowed != nil && req.Method != http.MethodTrace && req.Method != http.MethodConnect {
 			a.MethodNotAllowed.ServeHTTP(w, req)
 		} else {
-			httpError(w, MethodNotAllowed, req.Method)
+			// TRACE and CONNECT are always rejected here so that the request can never be reflected
+			// (cross-site tracing) or tunnelled by a custom handler
+			w.Header().Set(Allow, allowedMethods)
+			a.statusError(w, req, MethodNotAllowed)
+		}
+		return
+	}
+
+	if a.corsOrigins != nil {
+		a.setCORSHeaders(w.Header(), req)
+	}
+
+	if a.healthPath != "" && req.URL.Path == a.healthPath {
+		// cheap response without any filesystem access
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if a.rateLimit != nil {
+		if wait, ok := a.rateLimit.take(); !ok {
+			Debugf("Assets ServeHTTP (rate limited) %s %s\n", req.Method, req.URL.Path)
+			a.serveTooManyRequests(w, req, wait)
+			return
+		}
+	}
+
+	if a.breaker != nil {
+		if wait, open := a.breaker.open(); open {
+			// the filesystem is given time to recover
+			Debugf("Assets ServeHTTP (circuit open) %s %s\n", req.Method, req.URL.Path)
+			setRetryAfter(w.Header(), wait)
+			a.statusError(w, req, ServiceUnavailable)
+			return
+		}
+	}
+
+	if a.authorize != nil && !a.authorize(req) {
+		// no filesystem access is needed
+		Debugf("Assets ServeHTTP (unauthorized) %s %s\n", req.Method, req.URL.Path)
+		if a.unauthorized != nil {
+			a.setStatusCacheHeaders(w.Header(), req, Unauthorized)
+			a.unauthorized.ServeHTTP(w, req)
+		} else {
+			a.statusError(w, req, Unauthorized)
+		}
+		return
+	}
+
+	if a.allowedHosts != nil && !a.allowedHosts.Contains(hostname(req.Host)) {
+		// prevents assets being served under another host's name, e.g. due to connection coalescing
+		Debugf("Assets ServeHTTP (misdirected) %s %s %s\n", req.Method, req.Host, req.URL.Path)
+		a.statusError(w, req, MisdirectedRequest)
+		return
+	}
+
+	if containsControlChar(req.URL.Path) {
+		// the behaviour of the filesystem is undefined for such names, so they are rejected early
+		Debugf("Assets ServeHTTP (bad request) %s %q R:%s W:%s\n", req.Method, req.URL.Path,
+			headerStringer(req.Header), headerStringer(w.Header()))
+		a.statusError(w, req, BadRequest)
+		return
+	}
+
+	if target, redirect := a.canonicalTarget(req); redirect {
+		Debugf("Assets ServeHTTP (canonical host) %s %s to %s\n", req.Method, req.URL.Path, target)
+		http.Redirect(w, req, target, http.StatusMovedPermanently)
+		return
+	}
+
+	prefix, logical := path.Divide(req.URL.Path, a.UnwantedPrefixSegments)
+	if segmentCount(prefix) != a.UnwantedPrefixSegments {
+		// there is nothing left after the unwanted prefix segments, which might include empty ones
+		Debugf("Assets ServeHTTP (too few segments) %s %s\n", req.Method, req.URL.Path)
+		a.statusError(w, req, NotFound)
+		return
+	}
+
+	if target, redirect := a.lowercaseTarget(req, logical); redirect {
+		Debugf("Assets ServeHTTP (lowercase) %s %s to %s\n", req.Method, req.URL.Path, target)
+		http.Redirect(w, req, target, http.StatusMovedPermanently)
+		return
+	}
+
+	if a.buildToken != "" {
+		w.Header().Set(XBuild, a.buildToken)
+		w.Header().Add(Vary, XIfNoneBuild)
+	}
+
+	identity := a.identitySuffix != "" && strings.HasSuffix(logical, a.identitySuffix)
+	if identity {
+		logical = strings.TrimSuffix(logical, a.identitySuffix)
+		req = identityRequest(req)
+	}
+
+	resource, code := a.chooseResource(w.Header(), req, logical)
+
+	if a.breaker != nil {
+		// each request counts once, however many variants were tried
+		a.breaker.record(code == ServiceUnavailable)
+	}
+
+	if identity {
+		code = a.setIdentityHeaders(w.Header(), code)
+	}
+
+	if code == NotFound && (a.decompressFallback || identity) && !strings.HasSuffix(logical, "/") {
+		if gz := a.checkResource(logical+".gz", w.Header()); gz.code == OK {
+			// the asset only exists in compressed form but the client doesn't accept it
+			if !identity {
+				w.Header().Add(Vary, AcceptEncoding)
+			}
+			a.mergeVary(w.Header())
+			a.serveDecompressed(w, req, logical, gz, !identity)
+			return
+		}
+	}
+
+	if a.cacheByStatus != nil {
+		a.setStatusCacheHeaders(w.Header(), req, code)
+	}
+
+	if code == MovedPermanently {
+		// the original path is used so that any stripped prefix segments are retained
+		target := req.URL.Path + "/"
+		if strings.HasSuffix(req.URL.Path, "/") {
+			target = removeTrailingSlash(req.URL.Path)
+		}
+		if req.URL.RawQuery != "" {
+			target += "?" + req.URL.RawQuery
 		}
+		Debugf("Assets ServeHTTP (redirect) %s %s to %s\n", req.Method, req.URL.Path, target)
+		http.Redirect(w, req, target, int(code))
 		return
 	}
 
-	resource, code := a.chooseResource(w.Header(), req, path.Drop(req.URL.Path, a.UnwantedPrefixSegments))
+	if df, exists := a.defaultFiles[logical]; exists && code == NotFound {
+		Debugf("Assets ServeHTTP (default file) %s %s\n", req.Method, req.URL.Path)
+		a.serveDefaultFile(w, req, df)
+		return
+	}
 
 	if code == NotFound && a.NotFound != nil {
 		// use the provided not-found handler
 		Debugf("Assets ServeHTTP (not found) %s %s R:%s W:%s\n", req.Method, req.URL.Path,
 			headerStringer(req.Header), headerStringer(w.Header()))
+		if a.autoHead && req.Method == http.MethodHead {
+			w = headWriter{w}
+		}
 		a.NotFound.ServeHTTP(w, req)
 		return
 	}
@@ -243,17 +844,129 @@ func (a *Assets) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if code >= 400 {
 		Debugf("Assets ServeHTTP (error %d) %s %s R:%s W:%s\n", code, req.Method, req.URL.Path,
 			headerStringer(req.Header), headerStringer(w.Header()))
-		httpError(w, code, req.Method)
+		a.httpError(w, code, req.Method)
+		return
+	}
+
+	// responses with a nonce, like identity responses, are never cached, so they are always sent
+	nonced := a.cspNonce && code == OK && a.isHTML(logical)
+
+	if a.buildToken != "" && (code == OK || code == Directory) && !nonced && !identity &&
+		req.Header.Get(XIfNoneBuild) == a.buildToken {
+		// the client already has the current build of this asset
+		a.mergeVary(w.Header())
+		writeNotModified(w)
+		return
+	}
+
+	if a.headerRules != nil {
+		a.setRuleHeaders(w.Header(), logical)
+	}
+
+	if a.resolvedPathHeader {
+		w.Header().Set(XResolvedPath, resource)
+	}
+
+	var nonce string
+	if nonced {
+		nonce = newNonce()
+		a.setNonceHeaders(w.Header(), nonce)
+	} else if a.contentSecurityPolicy != "" && a.isHTML(logical) {
+		w.Header().Set(ContentSecurityPolicy, a.withReportTo(a.contentSecurityPolicy))
+	}
+
+	if a.reportingName != "" && a.isHTML(logical) {
+		w.Header().Set(ReportingEndpoints, a.reportingEndpoints())
+	}
+
+	if a.permissionsPolicy != "" && a.isHTML(logical) {
+		w.Header().Set(PermissionsPolicy, a.permissionsPolicy)
+	}
+
+	if a.crossOriginIsolation {
+		if a.isHTML(logical) {
+			w.Header().Set(CrossOriginOpenerPolicy, "same-origin")
+			w.Header().Set(CrossOriginEmbedderPolicy, "require-corp")
+		} else {
+			w.Header().Set(CrossOriginResourcePolicy, "cross-origin")
+		}
+	}
+
+	if sunset, exists := a.sunset[logical]; exists && code == OK {
+		w.Header().Set(Deprecation, "true")
+		w.Header().Set(Sunset, sunset.UTC().Format(http.TimeFormat))
+	}
+
+	gzipListing := code == Directory && a.compressListing(w.Header(), req)
+	if gzipListing {
+		defer a.endCompression()
+	}
+
+	a.mergeVary(w.Header())
+
+	if code == OK && (a.etags != nil || a.preloaded != nil) && notModified(req, w.Header()) {
+		// the cached ETag matches, so there is no need to open the file
+		writeNotModified(w)
 		return
 	}
 
 	original := req.URL.Path
 	req.URL.Path = resource
 
+	fw := &fixedHeaderWriter{ResponseWriter: w, fixed: make(http.Header), fixedOK: make(http.Header)}
+
+	if acceptRanges := w.Header().Get(AcceptRanges); acceptRanges != "" {
+		// the standard library always sets its own value, so ours has to be reinstated afterwards
+		fw.fixed.Set(AcceptRanges, acceptRanges)
+	}
+
+	if contentLength := w.Header().Get(ContentLength); contentLength != "" {
+		// the standard library omits the length of compressed content; this restores it for
+		// complete responses only, because other responses (e.g. 206, 304) differ
+		w.Header().Del(ContentLength)
+		fw.fixedOK.Set(ContentLength, contentLength)
+	}
+
+	if len(fw.fixed) > 0 || len(fw.fixedOK) > 0 {
+		w = fw
+	}
+
+	if a.emptyHeadNoContent && req.Method == http.MethodHead && code == OK {
+		w = &emptyHeadWriter{ResponseWriter: w}
+	}
+
 	// Conditional requests and content negotiation are handled in the standard net/http API.
 	// Note that req.URL remains unchanged, even if prefix stripping is turned on, because the resource is
 	// the only value that matters.
-	a.server.ServeHTTP(w, req)
+	modTime := a.lastModified(w.Header())
+
+	if code == OK && a.altersHTML(logical) {
+		a.serveAlteredHTML(w, req, resource, modTime, nonce)
+	} else if code == OK && w.Header().Get(ContentEncoding) == dictionaryEncoding {
+		a.serveDictionaryCompressed(w, req, resource, modTime)
+	} else if code == OK && identity {
+		a.serveUnvalidated(w, req, resource)
+	} else if mf := a.preloaded[resource]; mf != nil {
+		if modTime.IsZero() {
+			modTime = mf.modTime
+		}
+		http.ServeContent(w, req, resource, modTime, bytes.NewReader(mf.content))
+	} else if !modTime.IsZero() || (strings.HasSuffix(logical, "/") && strings.HasSuffix(resource, "/"+IndexPage)) {
+		a.serveFile(w, req, resource, modTime)
+	} else if (a.noStdlibRedirects || (a.noIndexResolution && path.Base(resource) == IndexPage)) && code == OK {
+		// files served directly are never redirected
+		a.serveFile(w, req, resource, modTime)
+	} else {
+		if a.noStdlibRedirects {
+			w = &noRedirectWriter{ResponseWriter: w, a: a, method: req.Method}
+		}
+		if gzipListing {
+			zw := &gzipWriter{ResponseWriter: w}
+			defer zw.Close()
+			w = zw
+		}
+		a.server.ServeHTTP(w, req)
+	}
 
 	Debugf("Assets (ok %d) %s %s (was %s) R:%s W:%s\n", code, req.Method, req.URL.Path, original,
 		headerStringer(req.Header), headerStringer(w.Header()))
@@ -261,3 +974,188 @@ func (a *Assets) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// leave the path as we found it, in case middleware depends on the original value
 	req.URL.Path = original
 }
+
+// lastModified gets the modification time already chosen for the response, if any.
+func (a *Assets) lastModified(wHeader http.Header) time.Time {
+	if lm := wHeader.Get(LastModified); lm != "" {
+		if t, err := http.ParseTime(lm); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// readResource reads the whole content of a file, which might be preloaded. The modification
+// time of the file is returned unless modTime is non-zero.
+func (a *Assets) readResource(resource string, modTime time.Time) ([]byte, time.Time, error) {
+	if mf := a.preloaded[resource]; mf != nil {
+		if modTime.IsZero() {
+			modTime = mf.modTime
+		}
+		return mf.content, modTime, nil
+	}
+
+	name := removeLeadingSlash(resource)
+	fi, err := fs.Stat(a.fs, name)
+	if err != nil {
+		return nil, modTime, err
+	}
+
+	content, err := fs.ReadFile(a.fs, name)
+	if modTime.IsZero() {
+		modTime = fi.ModTime()
+	}
+	return content, modTime, err
+}
+
+// serveFile serves a file directly, bypassing http.FileServer. This is needed, for example, for
+// an index file served for its directory path because http.FileServer would redirect any path
+// ending "/index.html" to its directory. The modification time of the file is used unless modTime
+// is non-zero.
+func (a *Assets) serveFile(w http.ResponseWriter, req *http.Request, resource string, modTime time.Time) {
+	f, err := a.fs.Open(removeLeadingSlash(resource))
+	if err != nil {
+		Debugf("Assets serve file %s %v\n", resource, err)
+		a.httpError(w, ServiceUnavailable, req.Method)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		Debugf("Assets serve file %s %v\n", resource, err)
+		a.httpError(w, ServiceUnavailable, req.Method)
+		return
+	}
+
+	content, isSeeker := f.(io.ReadSeeker)
+	if !isSeeker {
+		// fall back to reading the whole file into memory
+		b, err := io.ReadAll(f)
+		if err != nil {
+			Debugf("Assets serve file %s %v\n", resource, err)
+			a.httpError(w, ServiceUnavailable, req.Method)
+			return
+		}
+		content = bytes.NewReader(b)
+	}
+
+	if modTime.IsZero() {
+		modTime = fi.ModTime()
+	}
+
+	http.ServeContent(w, req, resource, modTime, content)
+}
+
+// mergeVary adds the extra Vary fields, if any, combining them with the existing ones into a
+// single header.
+func (a *Assets) mergeVary(wHeader http.Header) {
+	if len(a.extraVary) == 0 {
+		return
+	}
+
+	var fields List[string]
+	for _, f := range append(wHeader.Values(Vary), a.extraVary...) {
+		for _, field := range commaSeparatedList(f) {
+			field = http.CanonicalHeaderKey(field)
+			if field != "" && !fields.Contains(field) {
+				fields = append(fields, field)
+			}
+		}
+	}
+	wHeader.Set(Vary, strings.Join(fields, ", "))
+}
+
+func (a *Assets) logSlowServe(method, path string, start time.Time) {
+	if elapsed := time.Since(start); elapsed > a.slowServeThreshold {
+		Debugf("Assets ServeHTTP (slow) %s %s took %v\n", method, path, elapsed)
+	}
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// fixedHeaderWriter reinstates some header values just before a successful response is committed,
+// overriding any values that the standard library might have set in the meantime. The fixedOK
+// values are only used for 200-OK responses.
+type fixedHeaderWriter struct {
+	http.ResponseWriter
+	fixed   http.Header
+	fixedOK http.Header
+	started bool
+}
+
+func (w *fixedHeaderWriter) WriteHeader(code int) {
+	if !w.started {
+		w.started = true
+		h := w.ResponseWriter.Header()
+		if code < 300 {
+			for k, v := range w.fixed {
+				h[k] = v
+			}
+		}
+		if code == http.StatusOK {
+			for k, v := range w.fixedOK {
+				h[k] = v
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *fixedHeaderWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// noRedirectWriter replaces any redirection from the standard library with a 404-not found
+// response, so that the Location header, which is based on the rewritten path, is never sent.
+type noRedirectWriter struct {
+	http.ResponseWriter
+	a          *Assets
+	method     string
+	suppressed bool
+}
+
+func (w *noRedirectWriter) WriteHeader(code int) {
+	if code >= 300 && code < 400 && code != http.StatusNotModified {
+		w.suppressed = true
+		w.ResponseWriter.Header().Del(Location)
+		w.a.httpError(w.ResponseWriter, NotFound, w.method)
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *noRedirectWriter) Write(b []byte) (int, error) {
+	if w.suppressed {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// emptyHeadWriter replaces a 200-OK response to a HEAD request with 204-no content if the
+// resource is empty.
+type emptyHeadWriter struct {
+	http.ResponseWriter
+}
+
+func (w *emptyHeadWriter) WriteHeader(code int) {
+	h := w.ResponseWriter.Header()
+	if code == http.StatusOK && h.Get(ContentLength) == "0" {
+		// a 204 response must not have a Content-Length
+		h.Del(ContentLength)
+		code = http.StatusNoContent
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// headWriter discards the response body, as required for HEAD requests.
+type headWriter struct {
+	http.ResponseWriter
+}
+
+func (w headWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
@@ -0,0 +1,106 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+type headerRule struct {
+	pattern string
+	name    string
+	value   string
+}
+
+// WithHeaderRule alters the handler so that successful responses for assets matching the pattern
+// have the specified header. The pattern uses the syntax of path.Match and is tested as follows:
+//
+//   - a pattern ending with "/" matches every asset below that directory, e.g. "/img/"
+//   - a pattern containing "/" matches the whole asset path, e.g. "/css/*.css"
+//   - otherwise, the pattern matches the file name in any directory, e.g. "*.html"
+//
+// Every matching rule applies, in the order they were added; a later rule for the same header
+// replaces an earlier one. This method panics if the pattern is malformed.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithHeaderRule(pattern, name, value string) *Assets {
+	if _, err := path.Match(pattern, ""); err != nil {
+		panic(fmt.Sprintf("Bad header rule pattern %q", pattern))
+	}
+	rules := make([]headerRule, len(a.headerRules), len(a.headerRules)+1)
+	copy(rules, a.headerRules)
+	a.headerRules = append(rules, headerRule{pattern: pattern, name: name, value: value})
+	return &a
+}
+
+// WithClearSiteData alters the handler so that successful responses for assets matching the
+// pattern have a Clear-Site-Data header (see https://www.w3.org/TR/clear-site-data/) with the
+// specified directives, e.g. "cache". This tells browsers to discard data for the site, e.g. after
+// logging out. The pattern is as for WithHeaderRule.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithClearSiteData(pattern string, directives ...string) *Assets {
+	quoted := make([]string, len(directives))
+	for i, d := range directives {
+		quoted[i] = `"` + strings.Trim(d, `"`) + `"`
+	}
+	return a.WithHeaderRule(pattern, ClearSiteData, strings.Join(quoted, ", "))
+}
+
+// hasCacheControlRule is true if any rule sets the Cache-Control header of the resource.
+func (a *Assets) hasCacheControlRule(resource string) bool {
+	resource = "/" + removeLeadingSlash(resource)
+	for _, rule := range a.headerRules {
+		if http.CanonicalHeaderKey(rule.name) == CacheControl && patternMatches(rule.pattern, resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// patternMatches tests a rule pattern against a resource path, which has a leading slash.
+func patternMatches(pattern, resource string) bool {
+	switch {
+	case strings.HasSuffix(pattern, "/"):
+		return strings.HasPrefix(resource, path.Join("/", pattern)+"/") || pattern == "/"
+	case strings.Contains(pattern, "/"):
+		matched, _ := path.Match("/"+removeLeadingSlash(pattern), resource)
+		return matched
+	default:
+		matched, _ := path.Match(pattern, path.Base(resource))
+		return matched
+	}
+}
+
+// setRuleHeaders sets the headers from every rule that matches the resource.
+func (a *Assets) setRuleHeaders(wHeader http.Header, resource string) {
+	resource = "/" + removeLeadingSlash(resource)
+	for _, rule := range a.headerRules {
+		if patternMatches(rule.pattern, resource) {
+			wHeader.Set(rule.name, rule.value)
+		}
+	}
+}
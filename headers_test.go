@@ -0,0 +1,83 @@
+package servefiles
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServeHTTPWithClearSiteData(t *testing.T) {
+	a := NewAssetHandler("./assets/").
+		WithClearSiteData("/js/script1.js", "cache").
+		WithClearSiteData("*.png", "cache", `"cookies"`)
+
+	cases := []struct {
+		url, encoding string
+		code          int
+		clearSiteData string
+	}{
+		{url: "/js/script1.js", encoding: "xx", code: 200, clearSiteData: `"cache"`},
+		{url: "/js/script1.js", encoding: "gzip", code: 200, clearSiteData: `"cache"`},
+		{url: "/img/sort_asc.png", encoding: "xx", code: 200, clearSiteData: `"cache", "cookies"`},
+		{url: "/js/script2.js", encoding: "xx", code: 200, clearSiteData: ""},
+		{url: "/css/style1.css", encoding: "xx", code: 200, clearSiteData: ""},
+		{url: "/js/missing.png", encoding: "xx", code: 404, clearSiteData: ""},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Clear-Site-Data"), test.clearSiteData, i)
+	}
+}
+
+func TestServeHTTPWithHeaderRule(t *testing.T) {
+	a := NewAssetHandler("./assets/").
+		WithHeaderRule("/css/", "X-Robots-Tag", "noindex").
+		WithHeaderRule("style2.css", "X-Robots-Tag", "none")
+
+	cases := []struct {
+		url, value string
+	}{
+		{url: "/css/style1.css", value: "noindex"},
+		{url: "/css/style2.css", value: "none"},
+		{url: "/js/script1.js", value: ""},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("X-Robots-Tag"), test.value, i)
+	}
+}
+
+func TestPatternMatches(t *testing.T) {
+	cases := []struct {
+		pattern, resource string
+		matches           bool
+	}{
+		{pattern: "*.css", resource: "/css/style1.css", matches: true},
+		{pattern: "*.css", resource: "/style1.css", matches: true},
+		{pattern: "*.css", resource: "/css/style1.css.map", matches: false},
+		{pattern: "/css/*.css", resource: "/css/style1.css", matches: true},
+		{pattern: "css/*.css", resource: "/css/style1.css", matches: true},
+		{pattern: "/css/*.css", resource: "/css/a/style1.css", matches: false},
+		{pattern: "/img/", resource: "/img/a/b.png", matches: true},
+		{pattern: "img/", resource: "/img/a.png", matches: true},
+		{pattern: "/img/", resource: "/imgs/a.png", matches: false},
+		{pattern: "/", resource: "/anything", matches: true},
+	}
+
+	for i, test := range cases {
+		isEqual(t, patternMatches(test.pattern, test.resource), test.matches, i)
+	}
+}
@@ -0,0 +1,137 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WithIdentitySuffix alters the handler so that a request for an asset path with the specified
+// suffix appended (e.g. "/css/style.css.raw" for suffix ".raw") always receives the identity (i.e.
+// uncompressed) form of the asset, regardless of the Accept-Encoding header. If the asset exists
+// only as a gzipped file, it is decompressed. This is intended for debugging tools.
+//
+// Otherwise, these requests are handled like any other, e.g. aliases and header rules apply. The
+// responses have "Cache-Control: no-store" and neither ETag nor Last-Modified so they are not
+// cached and conditional requests always receive the whole asset. Index pages are served like any
+// other file, without redirection.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithIdentitySuffix(suffix string) *Assets {
+	a.identitySuffix = suffix
+	return &a
+}
+
+// identityRequest copies a request so that no compressed variant is chosen for it.
+func identityRequest(req *http.Request) *http.Request {
+	req = req.Clone(req.Context())
+	req.Header.Del(AcceptEncoding)
+	return req
+}
+
+// setIdentityHeaders prevents caching and removes the validators, so that conditional requests
+// always receive the whole asset. Directories have no identity form.
+func (a *Assets) setIdentityHeaders(wHeader http.Header, code code) code {
+	wHeader.Set(CacheControl, "no-store")
+	wHeader.Del(Expires)
+	wHeader.Del(ETag)
+	wHeader.Del(LastModified)
+
+	if code == Directory || code == MovedPermanently {
+		return NotFound
+	}
+	return code
+}
+
+// serveUnvalidated serves a file without a Last-Modified header, so that conditional requests
+// always receive the whole asset. Unless preloaded, the file is streamed.
+func (a *Assets) serveUnvalidated(w http.ResponseWriter, req *http.Request, resource string) {
+	if mf := a.preloaded[resource]; mf != nil {
+		http.ServeContent(w, req, resource, time.Time{}, bytes.NewReader(mf.content))
+		return
+	}
+	// ServeContent treats the Unix epoch like the zero time, whereas serveFile would replace
+	// the zero time with the file's modification time
+	a.serveFile(w, req, resource, time.Unix(0, 0))
+}
+
+// WithDecompressFallback alters the handler for deployments in which some assets exist only as
+// gzipped files, e.g. "app.js.gz" without "app.js". Clients that accept gzip are served the gzipped
+// file in the usual way. Without this option, other clients receive a 404-not found response; with
+// it, the gzipped file is decompressed for them on the fly. The decompressed response has a weak
+// ETag that differs from the one for the gzipped response.
+//
+// Note that decompression happens for every such request; consider PreloadCompressed for
+// frequently-used assets.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithDecompressFallback() *Assets {
+	a.decompressFallback = true
+	return &a
+}
+
+// serveDecompressed serves the decompressed content of a gzipped file. Unless it is cacheable,
+// there are no validators, so conditional requests always receive the whole content.
+func (a *Assets) serveDecompressed(w http.ResponseWriter, req *http.Request, resource string, gz fileData, cacheable bool) {
+	content, err := a.gunzip(gz)
+	if err != nil {
+		Debugf("Assets decompress %s %v\n", gz.resource, err)
+		a.httpError(w, ServiceUnavailable, req.Method)
+		return
+	}
+
+	w.Header().Set(ContentType, a.contentType(resource))
+	var modTime time.Time
+	if cacheable {
+		modTime = gz.fi.ModTime()
+		mf := &memFile{name: resource, content: content, modTime: modTime}
+		// weak etag because the representation is derived from a compressed variant
+		w.Header().Set(ETag, "W/"+a.etag(resource, mf))
+	}
+	http.ServeContent(w, req, resource, modTime, bytes.NewReader(content))
+}
+
+func (a *Assets) gunzip(fd fileData) ([]byte, error) {
+	var r io.Reader
+	if mf, isMem := fd.fi.(*memFile); isMem {
+		r = bytes.NewReader(mf.content)
+	} else {
+		f, err := a.fs.Open(removeLeadingSlash(fd.resource))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(zr)
+}
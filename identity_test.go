@@ -0,0 +1,154 @@
+package servefiles
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rickb777/servefiles/v3/afero2"
+	"github.com/spf13/afero"
+)
+
+func TestServeHTTPWithIdentitySuffix(t *testing.T) {
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	zw.Write([]byte("function app() {}\n"))
+	zw.Close()
+
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/js/app.js.gz", buf.Bytes(), 0644)
+
+	cases := []struct {
+		a       *Assets
+		url     string
+		code    int
+		conType string
+		body    string
+	}{
+		{a: NewAssetHandler("./assets/"), url: "/css/style2.css.raw", code: 200, conType: cssMimeType, body: "body {\n    background: #FF71A1;\n}\n"},
+		{a: NewAssetHandler("./assets/"), url: "/js/script2.js.raw", code: 200, conType: javascriptMimeType, body: "function foo2() {\n}\n"},
+		{a: NewAssetHandlerFS(mfs), url: "/js/app.js.raw", code: 200, conType: javascriptMimeType, body: "function app() {}\n"},
+		{a: NewAssetHandler("./assets/"), url: "/index.html.raw", code: 200, conType: htmlMimeType, body: "<html><body>index page</body></html>"},
+		{a: NewAssetHandler("./assets/"), url: "/js/nonexisting.js.raw", code: 404, conType: "text/plain; charset=utf-8", body: "404 Not found\n"},
+		{a: NewAssetHandler("./assets/"), url: "/css.raw", code: 404, conType: "text/plain; charset=utf-8", body: "404 Not found\n"},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		request.Header.Set("Accept-Encoding", "br, gzip")
+		// the validators are omitted, so this never gives 304-not modified
+		request.Header.Set("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+		a := test.a.WithMaxAge(time.Hour).WithIdentitySuffix(".raw")
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Content-Type"), test.conType, i)
+		isEqual(t, w.Header().Get("Content-Encoding"), "", i)
+		isEqual(t, w.Header().Get("Cache-Control"), "no-store", i)
+		isEqual(t, w.Header().Get("Expires"), "", i)
+		isEqual(t, w.Header().Get("Etag"), "", i)
+		isEqual(t, w.Header().Get("Last-Modified"), "", i)
+		isEqual(t, w.Body.String(), test.body, i)
+	}
+}
+
+func TestServeHTTPWithIdentitySuffixFollowsPolicies(t *testing.T) {
+	a := NewAssetHandler("./assets/").
+		WithAliasMap(map[string]string{"/theme.css": "css/style2.css"}).
+		WithHeaderRule("*.css", "X-Rule", "yes").
+		WithIdentitySuffix(".raw")
+
+	request, _ := http.NewRequest("GET", "/theme.css.raw", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+
+	a.ServeHTTP(w, request)
+
+	isEqual(t, w.Code, http.StatusOK, 0)
+	isEqual(t, w.Header().Get("Content-Encoding"), "", 0)
+	isEqual(t, w.Header().Get("X-Rule"), "yes", 0)
+	isEqual(t, w.Header().Get("Cache-Control"), "no-store", 0)
+	isEqual(t, w.Body.String(), "body {\n    background: #FF71A1;\n}\n", 0)
+}
+
+func TestServeHTTPCompressedOnly(t *testing.T) {
+	content := []byte("function app() {}\n")
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	zw.Write(content)
+	zw.Close()
+
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/js/app.js.gz", buf.Bytes(), 0644)
+	fi, err := mfs.Stat("/js/app.js.gz")
+	must(err)
+	gzEtag := "W/" + calculateEtag(fi)
+	identityEtag := "W/" + calculateEtag(&memFile{content: content, modTime: fi.ModTime()})
+	gzLen := fmt.Sprintf("%d", buf.Len())
+	identityLen := fmt.Sprintf("%d", len(content))
+
+	cases := []struct {
+		method, encoding, ifNoneMatch string
+		fallback                      bool
+		code                          int
+		conEnc, conLen, etag          string
+		body                          int
+	}{
+		// gzip-capable clients
+		{method: "GET", encoding: "gzip", code: 200, conEnc: "gzip", etag: gzEtag, conLen: gzLen, body: buf.Len()},
+		{method: "HEAD", encoding: "gzip", code: 200, conEnc: "gzip", etag: gzEtag, conLen: gzLen, body: 0},
+		{method: "GET", encoding: "gzip", ifNoneMatch: gzEtag, code: 304, etag: gzEtag, body: 0},
+		{method: "GET", encoding: "gzip", fallback: true, code: 200, conEnc: "gzip", etag: gzEtag, conLen: gzLen, body: buf.Len()},
+
+		// other clients, without the fallback
+		{method: "GET", encoding: "xx", code: 404, conLen: "14", body: 14},
+		{method: "HEAD", encoding: "xx", code: 404, body: 0},
+
+		// other clients, with the fallback
+		{method: "GET", encoding: "xx", fallback: true, code: 200, etag: identityEtag, conLen: identityLen, body: len(content)},
+		{method: "HEAD", encoding: "xx", fallback: true, code: 200, etag: identityEtag, conLen: identityLen, body: 0},
+		{method: "GET", encoding: "xx", ifNoneMatch: identityEtag, fallback: true, code: 304, etag: identityEtag, body: 0},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest(test.method, "/js/app.js", nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		if test.ifNoneMatch != "" {
+			request.Header.Set("If-None-Match", test.ifNoneMatch)
+		}
+		a := NewAssetHandlerFS(mfs)
+		if test.fallback {
+			a = a.WithDecompressFallback()
+		}
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Content-Encoding"), test.conEnc, i)
+		isEqual(t, w.Header().Get("Content-Length"), test.conLen, i)
+		isEqual(t, w.Header().Get("Etag"), test.etag, i)
+		isEqual(t, w.Body.Len(), test.body, i)
+		if test.code != 404 {
+			isEqual(t, w.Header().Get("Vary"), "Accept-Encoding", i)
+		}
+	}
+
+	// a range request must not claim the length of the whole file
+	request, _ := http.NewRequest("GET", "/js/app.js", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	request.Header.Set("Range", "bytes=0-3")
+	w := httptest.NewRecorder()
+
+	NewAssetHandlerFS(mfs).ServeHTTP(w, request)
+
+	isEqual(t, w.Code, http.StatusPartialContent, "range")
+	isNotEqual(t, w.Header().Get("Content-Length"), gzLen, "range")
+	isEqual(t, w.Body.Len(), 4, "range")
+}
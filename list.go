@@ -0,0 +1,145 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// List gets the logical paths of all the assets that can be served, e.g. "/css/style.css". This is
+// useful for generating precache manifests, sitemaps and the like. Compressed variants such as
+// "/css/style.css.gz" are not included because they are implementation details; however their
+// original path is included, even if only the compressed files exist. Directories named like
+// compressed variants, e.g. "/css/style.css.gz/", are skipped because they are never used as such.
+//
+// The result is sorted. For very large trees, ListFunc avoids holding all the paths in memory.
+func (a *Assets) List() ([]string, error) {
+	var list []string
+	err := a.ListFunc(func(p string) error {
+		list = append(list, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(list)
+	return list, nil
+}
+
+// ListFunc walks the filesystem and calls fn for the logical path of every asset that can be
+// served, as described for List. The paths are supplied in lexical order within each directory,
+// except that an asset that exists only in compressed form is supplied after its siblings and
+// the contents of its sibling directories.
+// Walking stops if fn returns an error, which is then returned.
+func (a *Assets) ListFunc(fn func(path string) error) error {
+	// the directories being walked, innermost last; a directory's compressed-only assets are
+	// supplied when the walk leaves it, which may be after walking its subdirectories
+	var open []*listedDir
+
+	leave := func(d *listedDir) error {
+		for _, p := range d.compressedOnly {
+			if _, exists := d.seen[p]; !exists {
+				d.seen[p] = struct{}{}
+				if err := fn(p); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	err := fs.WalkDir(a.fs, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if _, isVariant := variantExt(name); isVariant && name != "." {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		parent := path.Dir(name)
+		for len(open) > 0 && !isWithin(parent, open[len(open)-1].dir) {
+			if err := leave(open[len(open)-1]); err != nil {
+				return err
+			}
+			open = open[:len(open)-1]
+		}
+		if len(open) == 0 || open[len(open)-1].dir != parent {
+			open = append(open, &listedDir{dir: parent, seen: make(map[string]struct{})})
+		}
+		current := open[len(open)-1]
+
+		p := "/" + name
+		if ext, isVariant := variantExt(p); isVariant {
+			current.compressedOnly = append(current.compressedOnly, strings.TrimSuffix(p, ext))
+			return nil
+		}
+
+		current.seen[p] = struct{}{}
+		return fn(p)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		if err := leave(open[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listedDir holds the names found so far in one directory.
+type listedDir struct {
+	dir            string
+	seen           map[string]struct{}
+	compressedOnly []string
+}
+
+// isWithin is true if dir is the same as ancestor or is below it.
+func isWithin(dir, ancestor string) bool {
+	return ancestor == "." || dir == ancestor || strings.HasPrefix(dir, ancestor+"/")
+}
+
+// variantExt gets the file extension of a compressed variant, if the name has one. The plain
+// zstd variants that are not yet served are included.
+func variantExt(name string) (string, bool) {
+	exts := []string{dictionaryExt, ".zst"}
+	for _, variant := range compressedVariants {
+		exts = append(exts, variant.ext)
+	}
+	for _, ext := range exts {
+		if strings.HasSuffix(name, ext) {
+			return ext, true
+		}
+	}
+	return "", false
+}
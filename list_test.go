@@ -0,0 +1,86 @@
+package servefiles
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/rickb777/servefiles/v3/afero2"
+	"github.com/spf13/afero"
+)
+
+func TestList(t *testing.T) {
+	a := NewAssetHandler("./assets/")
+
+	list, err := a.List()
+
+	isEqual(t, err, nil, 0)
+	isEqual(t, list, []string{
+		"/css/style1.css",
+		"/css/style2.css",
+		"/img/sort_asc.png",
+		"/index.html",
+		"/js/script1.js",
+		"/js/script2.js",
+	}, 0)
+}
+
+func TestListCompressedOnly(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/app.js.gz", []byte("x"), 0644)
+	afero.WriteFile(mfs, "/app.js.br", []byte("x"), 0644)
+	afero.WriteFile(mfs, "/app.js-x", []byte("x"), 0644)
+	afero.WriteFile(mfs, "/b/c.css", []byte("x"), 0644)
+	afero.WriteFile(mfs, "/b/c.css.gz", []byte("x"), 0644)
+	a := NewAssetHandlerFS(mfs)
+
+	list, err := a.List()
+
+	isEqual(t, err, nil, 0)
+	isEqual(t, list, []string{"/app.js", "/app.js-x", "/b/c.css"}, 0)
+}
+
+func TestListCompressedSiblingAfterSubdirectory(t *testing.T) {
+	a := NewAssetHandlerIoFS(fstest.MapFS{
+		"a/b.js":        {Data: []byte("x")},
+		"a/b.js.d/c":    {Data: []byte("x")},
+		"a/b.js.gz":     {Data: []byte("x")},
+		"a/only.js.d":   {Data: []byte("x")},
+		"a/only.js.e/f": {Data: []byte("x")},
+		"a/only.js.gz":  {Data: []byte("x")},
+	})
+
+	list, err := a.List()
+
+	isEqual(t, err, nil, 0)
+	isEqual(t, list, []string{"/a/b.js", "/a/b.js.d/c", "/a/only.js", "/a/only.js.d", "/a/only.js.e/f"}, 0)
+}
+
+func TestListExcludesZstdVariants(t *testing.T) {
+	a := NewAssetHandlerIoFS(fstest.MapFS{
+		"a/y.js":                 {Data: []byte("x")},
+		"a/y.js.zst":             {Data: []byte("x")},
+		"a/z.js.zst":             {Data: []byte("x")},
+		"a/w.js":                 {Data: []byte("x")},
+		"a/w.js" + dictionaryExt: {Data: []byte("x")},
+	})
+
+	list, err := a.List()
+
+	isEqual(t, err, nil, 0)
+	isEqual(t, list, []string{"/a/w.js", "/a/y.js", "/a/z.js"}, 0)
+}
+
+func TestListFuncStops(t *testing.T) {
+	a := NewAssetHandler("./assets/")
+	stop := errors.New("stop")
+	n := 0
+
+	err := a.ListFunc(func(p string) error {
+		n++
+		return stop
+	})
+
+	isEqual(t, err, stop, 0)
+	isEqual(t, n, 1, 0)
+}
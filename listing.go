@@ -0,0 +1,174 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"compress/gzip"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// WithoutIndexResolution alters the handler so that directory requests are never resolved to
+// their index page ("index.html"). Instead, they receive a directory listing or, if listings are
+// disabled (see DisableDirListing), a 404-not found response. Index pages are omitted from the
+// listings but can still be requested directly, like any other file. This suits handlers that
+// serve raw files only, e.g. for an API.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithoutIndexResolution() *Assets {
+	a.noIndexResolution = true
+	// the standard library would otherwise serve the index page in place of the listing
+	a.server = http.FileServer(noIndexFS{a.httpFS})
+	return &a
+}
+
+// noIndexFS hides index pages from the standard library's directory handling. Requests for an
+// index page itself never reach this because ServeHTTP serves them directly.
+type noIndexFS struct {
+	http.FileSystem
+}
+
+func (f noIndexFS) Open(name string) (http.File, error) {
+	if path.Base(name) == IndexPage {
+		return nil, os.ErrNotExist
+	}
+	file, err := f.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return noIndexDir{file}, nil
+}
+
+// noIndexDir omits index pages from directory listings. Only the http.File methods are exposed,
+// so the standard library uses Readdir rather than any ReadDir method of the underlying file.
+type noIndexDir struct {
+	http.File
+}
+
+func (d noIndexDir) Readdir(count int) ([]os.FileInfo, error) {
+	list, err := d.File.Readdir(count)
+	return slices.DeleteFunc(list, func(fi os.FileInfo) bool { return fi.Name() == IndexPage }), err
+}
+
+// WithCompressedDirListing alters the handler so that generated directory listings are
+// gzip-compressed on the fly when the client accepts it. Listings of large directories can be
+// big, yet, unlike files, they never have pre-compressed variants. Index pages are not affected;
+// they are served like any other file.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithCompressedDirListing() *Assets {
+	a.compressDirListing = true
+	return &a
+}
+
+// WithMaxConcurrentCompressions alters the handler so that no more than n on-the-fly compressions
+// (see WithCompressedDirListing) run at the same time. Beyond this limit, responses are not
+// compressed, rather than waiting, which bounds the CPU used by bursts of requests. Zero means
+// there is no limit, which is the default.
+//
+// The returned handler is a new copy of the original one. The limit is shared by all the copies
+// made from it subsequently.
+func (a Assets) WithMaxConcurrentCompressions(n int) *Assets {
+	if n < 0 {
+		panic("Negative compression limit")
+	}
+	a.compressions = nil
+	if n > 0 {
+		a.compressions = make(chan struct{}, n)
+	}
+	return &a
+}
+
+// compressListing decides whether a directory listing should be gzip-compressed, adding the
+// Vary header because the decision depends on the request. If it returns true, the caller must
+// call endCompression after the response has been written.
+func (a *Assets) compressListing(wHeader http.Header, req *http.Request) bool {
+	if !a.compressDirListing || !a.encodingEnabled("gzip") {
+		return false
+	}
+	wHeader.Add(Vary, AcceptEncoding)
+	acceptEncoding := commaSeparatedList(strings.Join(req.Header.Values(AcceptEncoding), ","))
+	return acceptEncoding.Contains("gzip") && a.compressionAllowed(req) && a.startCompression()
+}
+
+// startCompression is true if another on-the-fly compression may start now.
+func (a *Assets) startCompression() bool {
+	if a.compressions == nil {
+		return true
+	}
+	select {
+	case a.compressions <- struct{}{}:
+		return true
+	default:
+		// the limit has been reached
+		return false
+	}
+}
+
+func (a *Assets) endCompression() {
+	if a.compressions != nil {
+		<-a.compressions
+	}
+}
+
+// gzipWriter compresses the body of a successful response. Other responses, e.g. 304-not modified,
+// are passed through unaltered. Close must be called after the response has been written.
+type gzipWriter struct {
+	http.ResponseWriter
+	zw      *gzip.Writer
+	started bool
+}
+
+func (w *gzipWriter) WriteHeader(code int) {
+	if !w.started {
+		w.started = true
+		if code == http.StatusOK {
+			h := w.ResponseWriter.Header()
+			h.Set(ContentEncoding, "gzip")
+			h.Del(ContentLength)
+			w.zw = gzip.NewWriter(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.zw == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.zw.Write(b)
+}
+
+// Close flushes the compressed data, if any.
+func (w *gzipWriter) Close() error {
+	if w.zw == nil {
+		return nil
+	}
+	return w.zw.Close()
+}
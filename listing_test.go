@@ -0,0 +1,201 @@
+package servefiles
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rickb777/servefiles/v3/afero2"
+	"github.com/spf13/afero"
+)
+
+func TestServeHTTPWithCompressedDirListing(t *testing.T) {
+	cases := []struct {
+		a        *Assets
+		path     string
+		encoding string
+		conEnc   string
+		vary     string
+	}{
+		{a: NewAssetHandler("./assets/").WithCompressedDirListing(), path: "/css/", encoding: "gzip", conEnc: "gzip", vary: "Accept-Encoding"},
+		{a: NewAssetHandler("./assets/").WithCompressedDirListing(), path: "/css/", encoding: "br, gzip", conEnc: "gzip", vary: "Accept-Encoding"},
+		{a: NewAssetHandler("./assets/").WithCompressedDirListing(), path: "/css/", encoding: "xx", conEnc: "", vary: "Accept-Encoding"},
+		{a: NewAssetHandler("./assets/").WithCompressedDirListing().WithEnabledEncodings("br"), path: "/css/", encoding: "gzip", conEnc: "", vary: ""},
+		{a: NewAssetHandler("./assets/"), path: "/css/", encoding: "gzip", conEnc: "", vary: ""},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.path, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		w := httptest.NewRecorder()
+
+		test.a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Content-Type"), htmlMimeType, i)
+		isEqual(t, w.Header().Get("Content-Encoding"), test.conEnc, i)
+		isEqual(t, w.Header().Get("Vary"), test.vary, i)
+
+		var body io.Reader = w.Body
+		if test.conEnc == "gzip" {
+			zr, err := gzip.NewReader(w.Body)
+			must(err)
+			body = zr
+		}
+		b, err := io.ReadAll(body)
+		must(err)
+		isEqual(t, strings.Contains(string(b), "style1.css"), true, i)
+	}
+}
+
+func TestServeHTTPCompressedDirListingNotModified(t *testing.T) {
+	a := NewAssetHandler("./assets/").WithCompressedDirListing()
+
+	request, _ := http.NewRequest("GET", "/css/", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, request)
+	isEqual(t, w.Code, http.StatusOK, 0)
+
+	request.Header.Set("If-Modified-Since", w.Header().Get("Last-Modified"))
+	w = httptest.NewRecorder()
+	a.ServeHTTP(w, request)
+
+	isEqual(t, w.Code, http.StatusNotModified, 1)
+	isEqual(t, w.Header().Get("Content-Encoding"), "", 1)
+	isEqual(t, w.Body.Len(), 0, 1)
+}
+
+func TestServeHTTPWithListingForPrefix(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/public/downloads/app.zip", []byte("zip"), 0644)
+	afero.WriteFile(mfs, "/public/downloads/old/app-1.zip", []byte("zip"), 0644)
+	afero.WriteFile(mfs, "/public/downloads/private/key.txt", []byte("key"), 0644)
+	afero.WriteFile(mfs, "/public/docs/index.html", []byte("<html>docs</html>"), 0644)
+	afero.WriteFile(mfs, "/public/img/logo.png", []byte("png"), 0644)
+
+	a := NewAssetHandlerFS(mfs).
+		WithListingForPrefix("/public/downloads/", true).
+		WithListingForPrefix("public/downloads/private", false)
+	a.DisableDirListing = true
+
+	cases := []struct {
+		path string
+		code int
+		body string
+	}{
+		{path: "/public/downloads/", code: 200, body: "app.zip"},
+		{path: "/public/downloads/old/", code: 200, body: "app-1.zip"},
+		{path: "/public/downloads/private/", code: 404},
+		{path: "/public/downloads/private", code: 404},
+		{path: "/public/docs/", code: 200, body: "<html>docs</html>"},
+		{path: "/public/docs", code: 301},
+		{path: "/public/img/", code: 404},
+		{path: "/public/img", code: 404},
+		{path: "/public/", code: 404},
+		{path: "/public", code: 404},
+		{path: "/", code: 404},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		if test.body != "" {
+			isEqual(t, strings.Contains(w.Body.String(), test.body), true, i)
+		}
+	}
+}
+
+func TestListingForRootPrefix(t *testing.T) {
+	a := NewAssetHandler("./assets/").WithListingForPrefix("/", false)
+
+	for i, path := range []string{"/css/", "/css"} {
+		request, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusNotFound, i)
+	}
+}
+
+func TestServeHTTPWithMaxConcurrentCompressions(t *testing.T) {
+	a := NewAssetHandler("./assets/").WithCompressedDirListing().WithMaxConcurrentCompressions(2)
+
+	serve := func() string {
+		request, _ := http.NewRequest("GET", "/css/", nil)
+		request.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, request)
+		isEqual(t, w.Code, http.StatusOK, "")
+		isEqual(t, w.Header().Get("Vary"), "Accept-Encoding", "")
+		return w.Header().Get("Content-Encoding")
+	}
+
+	isEqual(t, serve(), "gzip", 0)
+
+	// simulates compressions that are in progress
+	isEqual(t, a.startCompression(), true, 1)
+	isEqual(t, serve(), "gzip", 1)
+	isEqual(t, a.startCompression(), true, 2)
+
+	// the limit has been reached
+	isEqual(t, serve(), "", 3)
+	isEqual(t, serve(), "", 4)
+
+	a.endCompression()
+	isEqual(t, serve(), "gzip", 5)
+
+	a.endCompression()
+	isEqual(t, len(a.compressions), 0, 6)
+}
+
+func TestServeHTTPWithoutIndexResolution(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/docs/index.html", []byte("<html>docs</html>"), 0644)
+	afero.WriteFile(mfs, "/docs/a.txt", []byte("a"), 0644)
+
+	cases := []struct {
+		testdata, resolve, disable bool
+		path                       string
+		code                       int
+		body                       string
+	}{
+		{path: "/docs/", code: 200, body: `<a href="a.txt">a.txt</a>`},
+		{path: "/docs/a.txt", code: 200, body: "a"},
+		{testdata: true, path: "/", code: 200, body: `<a href="css/">css/</a>`},
+		{path: "/docs/index.html", code: 200, body: "<html>docs</html>"},
+		{testdata: true, path: "/index.html", code: 200, body: "<html><body>index page</body></html>"},
+		{disable: true, path: "/docs/", code: 404, body: "404 Not found"},
+		{testdata: true, disable: true, path: "/", code: 404, body: "404 Not found"},
+		{resolve: true, path: "/docs/", code: 200, body: "<html>docs</html>"},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.path, nil)
+		a := NewAssetHandlerFS(mfs)
+		if test.testdata {
+			a = NewAssetHandler("./assets/")
+		}
+		if !test.resolve {
+			a = a.WithoutIndexResolution()
+		}
+		a.DisableDirListing = test.disable
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, strings.Contains(w.Body.String(), test.body), true, i)
+		if test.code == 200 && !test.resolve && strings.HasSuffix(test.path, "/") {
+			isEqual(t, strings.Contains(w.Body.String(), `href="index.html"`), false, i)
+		}
+	}
+}
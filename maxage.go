@@ -0,0 +1,107 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WithDefaultMaxAge alters the handler so that assets are given this max age unless a rule set by
+// WithHeaderRule gives them their own Cache-Control header, in which case they have no Expires
+// header either. When it is set, it is used instead of MaxAge; MaxAge remains the simpler API for
+// handlers that need only a single policy. Zero means there are no Expires or Cache-Control
+// headers, other than those from the rules. Any ceiling set by WithMaxAgeClamp still applies.
+// This method panics if maxAge is negative.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithDefaultMaxAge(maxAge time.Duration) *Assets {
+	if maxAge < 0 {
+		panic("Negative maxAge")
+	}
+	a.defaultMaxAge = maxAge
+	a.hasDefaultMaxAge = true
+	return &a
+}
+
+// WithCacheByStatus alters the handler so that the cache headers depend on the outcome of each
+// request. The map keys are status codes, e.g. 404, and the values are the max ages for responses
+// with those codes. Zero means the response has "Cache-Control: no-store" so it is never cached.
+// Statuses that are not in the map keep the usual behaviour. For example, 404 responses might be
+// cached briefly whereas 403 and 503 responses are never cached. This method panics if any max age
+// is negative.
+//
+// The status is the outcome decided by this handler before any conditional or range request is
+// evaluated, so the policy for 200 also applies to the resulting 304 and 206 responses. Directory
+// listings have status 200. Requests rejected before any file is looked up, e.g. with 401, 421 or
+// 429, are covered too.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithCacheByStatus(maxAges map[int]time.Duration) *Assets {
+	m := make(map[code]time.Duration, len(a.cacheByStatus)+len(maxAges))
+	for status, maxAge := range a.cacheByStatus {
+		m[status] = maxAge
+	}
+	for status, maxAge := range maxAges {
+		if maxAge < 0 {
+			panic("Negative maxAge")
+		}
+		m[code(status)] = maxAge
+	}
+	a.cacheByStatus = m
+	return &a
+}
+
+// setStatusCacheHeaders replaces the cache headers according to the outcome, if the
+// WithCacheByStatus policy has an entry for it.
+func (a *Assets) setStatusCacheHeaders(wHeader http.Header, req *http.Request, status code) {
+	if status == Directory {
+		status = OK
+	}
+
+	maxAge, exists := a.cacheByStatus[status]
+	if !exists || wHeader.Get(CacheControl) == "no-store" {
+		// the cache bypass header takes precedence
+		return
+	}
+
+	wHeader.Del(Expires)
+	if maxAge == 0 {
+		wHeader.Set(CacheControl, "no-store")
+	} else {
+		wHeader.Del(CacheControl)
+		a.setMaxAgeHeaders(wHeader, req, a.clamp(maxAge))
+	}
+}
+
+func (a *Assets) setMaxAgeHeaders(wHeader http.Header, req *http.Request, maxAge time.Duration) {
+	if maxAge > 0 {
+		if !a.omitExpires(req, maxAge) {
+			wHeader.Set(Expires, time.Now().Add(maxAge).UTC().Format(time.RFC1123))
+		}
+		wHeader.Set(CacheControl, fmt.Sprintf("%s, max-age=%d", a.cacheScope(), int(maxAge/time.Second)))
+	} else if a.varyCookie {
+		wHeader.Set(CacheControl, "private")
+	}
+}
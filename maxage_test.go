@@ -0,0 +1,169 @@
+package servefiles
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestServeHTTPWithDefaultMaxAge(t *testing.T) {
+	cases := []struct {
+		a            *Assets
+		url          string
+		cacheControl string
+		expires      bool
+	}{
+		// the default applies when no rule sets Cache-Control
+		{
+			a:            NewAssetHandler("./assets/").WithMaxAge(time.Minute).WithDefaultMaxAge(2*time.Hour).WithHeaderRule("*.css", "Cache-Control", "public, max-age=3600"),
+			url:          "/js/script2.js",
+			cacheControl: "public, max-age=7200",
+			expires:      true,
+		},
+		// a matching rule takes precedence over the default, which sets no Expires header either
+		{
+			a:            NewAssetHandler("./assets/").WithMaxAge(time.Minute).WithDefaultMaxAge(2*time.Hour).WithHeaderRule("*.css", "Cache-Control", "public, max-age=3600"),
+			url:          "/css/style1.css",
+			cacheControl: "public, max-age=3600",
+		},
+		// a zero default disables caching headers even though MaxAge is set
+		{
+			a:            NewAssetHandler("./assets/").WithMaxAge(time.Minute).WithDefaultMaxAge(0).WithHeaderRule("*.css", "Cache-Control", "public, max-age=3600"),
+			url:          "/js/script2.js",
+			cacheControl: "",
+		},
+		// without a default, MaxAge applies
+		{
+			a:            NewAssetHandler("./assets/").WithMaxAge(time.Minute).WithHeaderRule("*.css", "Cache-Control", "public, max-age=3600"),
+			url:          "/js/script2.js",
+			cacheControl: "public, max-age=60",
+			expires:      true,
+		},
+		// the clamp applies to the default too
+		{
+			a:            NewAssetHandler("./assets/").WithDefaultMaxAge(2 * time.Hour).WithMaxAgeClamp(time.Hour),
+			url:          "/js/script2.js",
+			cacheControl: "public, max-age=3600",
+			expires:      true,
+		},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		w := httptest.NewRecorder()
+
+		test.a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Cache-Control"), test.cacheControl, i)
+		isEqual(t, w.Header().Get("Expires") != "", test.expires, i)
+	}
+}
+
+func TestServeHTTPWithCacheByStatus(t *testing.T) {
+	policy := map[int]time.Duration{
+		200: 365 * 24 * time.Hour,
+		404: time.Minute,
+		403: 0,
+		503: 0,
+	}
+
+	cases := []struct {
+		a            *Assets
+		url          string
+		code         int
+		cacheControl string
+		expires      bool
+	}{
+		{a: NewAssetHandler("./assets/").WithMaxAge(time.Hour).WithCacheByStatus(policy), url: "/css/style1.css", code: 200, cacheControl: "public, max-age=31536000", expires: true},
+		{a: NewAssetHandler("./assets/").WithMaxAge(time.Hour).WithCacheByStatus(policy), url: "/css/", code: 200, cacheControl: "public, max-age=31536000", expires: true},
+		{a: NewAssetHandler("./assets/").WithMaxAge(time.Hour).WithCacheByStatus(policy), url: "/css/missing.css", code: 404, cacheControl: "public, max-age=60", expires: true},
+		{a: NewAssetHandlerFS(&fs403{os.ErrPermission}).WithMaxAge(time.Hour).WithCacheByStatus(policy), url: "/css/style1.css", code: 403, cacheControl: "no-store"},
+		{a: NewAssetHandlerFS(&fs403{os.ErrInvalid}).WithMaxAge(time.Hour).WithCacheByStatus(policy), url: "/css/style1.css", code: 503, cacheControl: "no-store"},
+		{a: NewAssetHandler("./assets/").WithMaxAge(time.Hour).WithCacheByStatus(map[int]time.Duration{404: 0}), url: "/css/style1.css", code: 200, cacheControl: "public, max-age=3600", expires: true},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		w := httptest.NewRecorder()
+
+		test.a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Cache-Control"), test.cacheControl, i)
+		isEqual(t, w.Header().Get("Expires") != "", test.expires, i)
+	}
+}
+
+func TestCacheByStatusForEarlyResponses(t *testing.T) {
+	policy := map[int]time.Duration{
+		401: 0,
+		421: time.Hour,
+		429: 0,
+		451: time.Hour,
+		503: 0,
+	}
+
+	base := NewAssetHandler("./assets/").WithCacheByStatus(policy)
+	limited := base.WithRateLimit(0.001, 1)
+	sfs := &saturatingFS{FS: fstest.MapFS{"css/style1.css": {Data: []byte("body {}\n")}}}
+	broken := NewAssetHandlerIoFS(sfs).WithCacheByStatus(policy).WithCircuitBreaker(1, time.Minute)
+
+	cases := []struct {
+		a            *Assets
+		host         string
+		repeat       bool
+		code         int
+		cacheControl string
+		expires      bool
+	}{
+		{a: base.WithAuthorize(func(*http.Request) bool { return false }, nil), code: 401, cacheControl: "no-store"},
+		{a: base.WithAllowedHosts([]string{"example.com"}), host: "example.org", code: 421, cacheControl: "public, max-age=3600", expires: true},
+		{a: limited, repeat: true, code: 429, cacheControl: "no-store"},
+		{a: base.WithLegalBlock(map[string]string{"/css/style1.css": ""}), code: 451, cacheControl: "public, max-age=3600", expires: true},
+		{a: broken, repeat: true, code: 503, cacheControl: "no-store"},
+	}
+
+	sfs.saturated = true
+
+	for i, test := range cases {
+		serve := func() *httptest.ResponseRecorder {
+			request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+			if test.host != "" {
+				request.Host = test.host
+			}
+			w := httptest.NewRecorder()
+			test.a.ServeHTTP(w, request)
+			return w
+		}
+
+		w := serve()
+		if test.repeat {
+			// the first request uses up the allowance or trips the breaker
+			w = serve()
+		}
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Cache-Control"), test.cacheControl, i)
+		isEqual(t, w.Header().Get("Expires") != "", test.expires, i)
+	}
+}
+
+func TestCacheByStatusBypassHeaderTakesPrecedence(t *testing.T) {
+	a := NewAssetHandler("./assets/").
+		WithMaxAge(time.Hour).
+		WithCacheBypassHeader("X-No-Cache").
+		WithCacheByStatus(map[int]time.Duration{200: 24 * time.Hour})
+
+	request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+	request.Header.Set("X-No-Cache", "1")
+	w := httptest.NewRecorder()
+
+	a.ServeHTTP(w, request)
+
+	isEqual(t, w.Code, http.StatusOK, 0)
+	isEqual(t, w.Header().Get("Cache-Control"), "no-store", 0)
+}
@@ -0,0 +1,94 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"net/http"
+)
+
+// Middleware gets the asset handler as net/http middleware. Each GET or HEAD request is first
+// tried against the assets; if no matching asset is found, the request falls through to the
+// next handler instead of receiving a 404 response. This allows the common "static files first,
+// app routes second" composition without needing a custom mux. Other request methods always
+// fall through.
+//
+// The NotFound handler, if any, is not used by the middleware.
+func (a *Assets) Middleware() func(http.Handler) http.Handler {
+	assets := *a
+	assets.NotFound = nil
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Method != http.MethodGet && req.Method != http.MethodHead {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			nw := &no404Writer{w: w, header: make(http.Header)}
+			assets.ServeHTTP(nw, req)
+			if nw.notFound {
+				next.ServeHTTP(w, req)
+			}
+		})
+	}
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// no404Writer holds back the response headers until the status is known. A 404-not found
+// response is discarded entirely so that a different handler can provide the response instead.
+// Only the headers are held back; the body is never buffered, so large files are streamed.
+type no404Writer struct {
+	w        http.ResponseWriter
+	header   http.Header
+	notFound bool
+	started  bool
+}
+
+func (w *no404Writer) Header() http.Header {
+	return w.header
+}
+
+func (w *no404Writer) WriteHeader(code int) {
+	if code == http.StatusNotFound {
+		w.notFound = true
+		return
+	}
+
+	w.started = true
+	h := w.w.Header()
+	for k, v := range w.header {
+		h[k] = v
+	}
+	w.w.WriteHeader(code)
+}
+
+func (w *no404Writer) Write(b []byte) (int, error) {
+	if w.notFound {
+		return len(b), nil
+	}
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.w.Write(b)
+}
@@ -0,0 +1,98 @@
+package servefiles
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	cases := []struct {
+		method, url string
+		code        int
+		body        string
+		expires     bool
+	}{
+		{method: "GET", url: "/js/script2.js", code: 200, body: "function foo2() {\n}\n", expires: true},
+		{method: "HEAD", url: "/js/script2.js", code: 200, body: "", expires: true},
+		{method: "GET", url: "/api/x", code: 200, body: "dynamic"},
+		{method: "POST", url: "/js/script2.js", code: 200, body: "dynamic"},
+	}
+
+	dynamic := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("dynamic"))
+	})
+
+	h := NewAssetHandler("./assets/").WithMaxAge(time.Hour).WithNotFound(&h4xx{code: 404}).Middleware()(dynamic)
+
+	for i, test := range cases {
+		request, _ := http.NewRequest(test.method, test.url, nil)
+		w := httptest.NewRecorder()
+
+		h.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Expires") != "", test.expires, i)
+		isEqual(t, w.Body.String(), test.body, i)
+	}
+}
+
+// chunkWriter discards the body, recording its size and the largest single write. A large
+// write would show that the whole file had been buffered somewhere.
+type chunkWriter struct {
+	header   http.Header
+	code     int
+	total    int64
+	maxChunk int
+}
+
+func (w *chunkWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *chunkWriter) WriteHeader(code int) {
+	w.code = code
+}
+
+func (w *chunkWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	w.total += int64(len(b))
+	w.maxChunk = max(w.maxChunk, len(b))
+	return len(b), nil
+}
+
+func TestLargeFilesAreStreamed(t *testing.T) {
+	const size = 8 << 20
+	dir := t.TempDir()
+	must(os.WriteFile(filepath.Join(dir, "large.bin"), make([]byte, size), 0644))
+
+	notFound := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "custom", http.StatusNotFound)
+	})
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "next", http.StatusTeapot)
+	})
+
+	cases := []http.Handler{
+		NewAssetHandler(dir).WithNotFound(notFound),
+		NewAssetHandler(dir).WithNotFound(notFound).WithOriginalLastModified(),
+		NewAssetHandler(dir).WithNotFound(notFound).Middleware()(next),
+	}
+
+	for i, h := range cases {
+		request, _ := http.NewRequest("GET", "/large.bin", nil)
+		w := &chunkWriter{header: make(http.Header)}
+
+		h.ServeHTTP(w, request)
+
+		isEqual(t, w.code, http.StatusOK, i)
+		isEqual(t, w.total, int64(size), i)
+		isEqual(t, w.maxChunk < 1<<20, true, i)
+	}
+}
@@ -0,0 +1,93 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// WithCSPNonce alters the handler so that every HTML response has a fresh random nonce. This is
+// added to the script-src directive of the Content-Security-Policy header, which is created if
+// WithContentSecurityPolicy has not been used. In the document, it replaces the value of every
+// existing nonce attribute of a script element, so trusted scripts are marked with a placeholder
+// such as nonce="". So these scripts can run under a strict policy, whereas other scripts, e.g.
+// those injected by an attacker, remain blocked. Templating middleware can find the nonce in the
+// header.
+//
+// Because the document differs for every response, these responses have "Cache-Control: no-store"
+// and no ETag or Last-Modified header. The document is altered in the same way as for
+// WithBaseHrefInjection, with the same limitations.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithCSPNonce() *Assets {
+	a.cspNonce = true
+	return &a
+}
+
+// nonceBytes is the number of random bytes in a nonce, as recommended by CSP3.
+const nonceBytes = 16
+
+var (
+	scriptTag = regexp.MustCompile(`(?i)<script(\s[^>]*)?>`)
+	nonceAttr = regexp.MustCompile(`(?i)\snonce\s*=\s*("[^"]*"|'[^']*'|[^\s>]*)`)
+	scriptSrc = regexp.MustCompile(`(?i)(^|;)\s*script-src\b`)
+)
+
+// newNonce generates a random base64 value.
+func newNonce() string {
+	b := make([]byte, nonceBytes)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// setNonceHeaders sets the Content-Security-Policy header with the nonce and prevents caching.
+func (a *Assets) setNonceHeaders(wHeader http.Header, nonce string) {
+	source := "'nonce-" + nonce + "'"
+	policy := a.contentSecurityPolicy
+	if loc := scriptSrc.FindStringIndex(policy); loc != nil {
+		policy = policy[:loc[1]] + " " + source + policy[loc[1]:]
+	} else if strings.TrimSpace(policy) != "" {
+		policy = strings.TrimRight(policy, "; ") + "; script-src " + source
+	} else {
+		policy = "script-src " + source
+	}
+	wHeader.Set(ContentSecurityPolicy, a.withReportTo(policy))
+
+	wHeader.Set(CacheControl, "no-store")
+	wHeader.Del(Expires)
+	wHeader.Del(ETag)
+	wHeader.Del(LastModified)
+}
+
+// injectNonce sets the value of the nonce attribute of those script elements in an HTML document
+// that already have one. Other script elements are left unchanged.
+func injectNonce(doc []byte, nonce string) []byte {
+	attr := []byte(` nonce="` + nonce + `"`)
+	return scriptTag.ReplaceAllFunc(doc, func(tag []byte) []byte {
+		return nonceAttr.ReplaceAllLiteral(tag, attr)
+	})
+}
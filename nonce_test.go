@@ -0,0 +1,98 @@
+package servefiles
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rickb777/servefiles/v3/afero2"
+	"github.com/spf13/afero"
+)
+
+func TestCSPNonce(t *testing.T) {
+	mfs := afero2.AferoAdapter{Inner: afero.NewMemMapFs()}
+	afero.WriteFile(mfs, "/index.html", []byte(`<html><script>go()</script><SCRIPT src="/app.js" nonce="old"></SCRIPT><script nonce="">ok()</script></html>`), 0644)
+	afero.WriteFile(mfs, "/index.html.gz", []byte("gzipped"), 0644)
+	afero.WriteFile(mfs, "/app.js", []byte("<script>"), 0644)
+
+	cases := []struct {
+		policy, expected string
+	}{
+		{policy: "", expected: "script-src 'nonce-N'"},
+		{policy: "default-src 'self'", expected: "default-src 'self'; script-src 'nonce-N'"},
+		{policy: "default-src 'self'; script-src 'self'; img-src *", expected: "default-src 'self'; script-src 'nonce-N' 'self'; img-src *"},
+	}
+
+	nonceInPolicy := regexp.MustCompile(`'nonce-([^']+)'`)
+
+	for i, test := range cases {
+		a := NewAssetHandlerFS(mfs).WithMaxAge(time.Hour).WithContentSecurityPolicy(test.policy).WithCSPNonce()
+
+		nonces := make(map[string]bool)
+		for j := 0; j < 2; j++ {
+			request, _ := http.NewRequest("GET", "/", nil)
+			request.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+
+			a.ServeHTTP(w, request)
+
+			isEqual(t, w.Code, http.StatusOK, i)
+			policy := w.Header().Get("Content-Security-Policy")
+			m := nonceInPolicy.FindStringSubmatch(policy)
+			isEqual(t, len(m), 2, i)
+			nonce := m[1]
+			nonces[nonce] = true
+
+			isEqual(t, strings.Replace(policy, nonce, "N", 1), test.expected, i)
+			// the script without a nonce attribute is not trusted
+			isEqual(t, w.Body.String(), `<html><script>go()</script><SCRIPT src="/app.js" nonce="`+nonce+`"></SCRIPT><script nonce="`+nonce+`">ok()</script></html>`, i)
+			isEqual(t, w.Header().Get("Content-Encoding"), "", i)
+			isEqual(t, w.Header().Get("Cache-Control"), "no-store", i)
+			isEqual(t, w.Header().Get("Expires"), "", i)
+			isEqual(t, w.Header().Get("ETag"), "", i)
+			isEqual(t, w.Header().Get("Last-Modified"), "", i)
+		}
+
+		// a fresh nonce for every response
+		isEqual(t, len(nonces), 2, i)
+
+		request, _ := http.NewRequest("GET", "/app.js", nil)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Header().Get("Content-Security-Policy"), "", i)
+		isEqual(t, w.Header().Get("Cache-Control"), "public, max-age=3600", i)
+		isEqual(t, w.Body.String(), "<script>", i)
+	}
+}
+
+func TestCSPNonceIgnoresBuildToken(t *testing.T) {
+	a := NewAssetHandler("./assets/").WithMaxAge(time.Hour).WithCSPNonce().WithIdentitySuffix(".raw").WithBuildToken("v1.2.3")
+
+	cases := []struct {
+		url  string
+		code int
+	}{
+		{url: "/", code: http.StatusOK},
+		{url: "/css/style1.css.raw", code: http.StatusOK},
+		{url: "/css/style1.css", code: http.StatusNotModified},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		request.Header.Set("X-If-None-Build", "v1.2.3")
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		if test.code == http.StatusOK {
+			isEqual(t, w.Header().Get("Cache-Control"), "no-store", i)
+			isNotEqual(t, w.Body.Len(), 0, i)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// memFile is an asset held in memory. It provides the os.FileInfo needed for the ETag.
+type memFile struct {
+	name    string
+	content []byte
+	modTime time.Time
+}
+
+func (m *memFile) Name() string       { return m.name }
+func (m *memFile) Size() int64        { return int64(len(m.content)) }
+func (m *memFile) Mode() fs.FileMode  { return 0444 }
+func (m *memFile) ModTime() time.Time { return m.modTime }
+func (m *memFile) IsDir() bool        { return false }
+func (m *memFile) Sys() any           { return nil }
+
+// PreloadCompressed alters the handler so that the specified assets are held in memory. Each asset
+// is read from the filesystem once, along with its gzip and brotli siblings if they exist. An asset
+// without a gzip sibling is compressed now so that a gzipped version is always available.
+//
+// Requests for these assets are then served from memory without any filesystem access. This is
+// intended for a small set of frequently-used assets, not as a general cache. Range and
+// conditional requests are supported for these assets just as for any others. The paths are
+// relative to the root of the filesystem, e.g. "css/style.css".
+//
+// The returned handler is a new copy of the original one. An error is returned if any of the
+// assets cannot be read.
+func (a Assets) PreloadCompressed(paths []string) (*Assets, error) {
+	preloaded := make(map[string]*memFile, len(a.preloaded)+3*len(paths))
+	for k, v := range a.preloaded {
+		preloaded[k] = v
+	}
+
+	for _, p := range paths {
+		name := removeLeadingSlash(p)
+
+		original, err := a.readMemFile(name)
+		if err != nil {
+			return nil, err
+		}
+		preloaded["/"+name] = original
+
+		for _, variant := range compressedVariants {
+			compressed, err := a.readMemFile(name + variant.ext)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+
+			if compressed == nil && variant.encoding == "gzip" {
+				compressed, err = gzipMemFile(original)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			// nil entries record that the compressed variant is absent
+			preloaded["/"+name+variant.ext] = compressed
+		}
+	}
+
+	a.preloaded = preloaded
+	return &a, nil
+}
+
+func (a *Assets) readMemFile(name string) (*memFile, error) {
+	fi, err := fs.Stat(a.fs, name)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := fs.ReadFile(a.fs, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &memFile{name: fi.Name(), content: content, modTime: fi.ModTime()}, nil
+}
+
+func gzipMemFile(original *memFile) (*memFile, error) {
+	buf := &bytes.Buffer{}
+	zw, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = zw.Write(original.content); err != nil {
+		return nil, err
+	}
+
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return &memFile{name: original.name + ".gz", content: buf.Bytes(), modTime: original.modTime}, nil
+}
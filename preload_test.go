@@ -0,0 +1,124 @@
+package servefiles
+
+import (
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingFS counts every access to the underlying filesystem, and separately the opens.
+type countingFS struct {
+	fs    fs.FS
+	count atomic.Int32
+	opens atomic.Int32
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	c.count.Add(1)
+	c.opens.Add(1)
+	return c.fs.Open(name)
+}
+
+func (c *countingFS) Stat(name string) (fs.FileInfo, error) {
+	c.count.Add(1)
+	return fs.Stat(c.fs, name)
+}
+
+func TestPreloadCompressed(t *testing.T) {
+	cases := []struct {
+		url, encoding, conEnc, path string
+		body                        int
+	}{
+		{url: "/css/style1.css", encoding: "br", conEnc: "br", path: "assets/css/style1.css.br", body: 31},
+		{url: "/css/style1.css", encoding: "gzip", conEnc: "gzip", path: "assets/css/style1.css.gz", body: 60},
+		{url: "/css/style1.css", encoding: "xx", conEnc: "", path: "assets/css/style1.css", body: 31},
+		{url: "/css/style2.css", encoding: "br, gzip", conEnc: "gzip", path: "", body: -1},
+		{url: "/css/style2.css", encoding: "xx", conEnc: "", path: "assets/css/style2.css", body: 34},
+	}
+
+	cfs := &countingFS{fs: os.DirFS("assets")}
+	a, err := NewAssetHandlerIoFS(cfs).WithMaxAge(time.Hour).PreloadCompressed([]string{"css/style1.css", "/css/style2.css"})
+	must(err)
+	cfs.count.Store(0)
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, http.StatusOK, i)
+		isEqual(t, w.Header().Get("Content-Type"), cssMimeType, i)
+		isEqual(t, w.Header().Get("Content-Encoding"), test.conEnc, i)
+		isEqual(t, w.Header().Get("Cache-Control"), "public, max-age=3600", i)
+		if test.path != "" {
+			isEqual(t, w.Body.Len(), test.body, i)
+			etag := etagFor(test.path)
+			if test.conEnc != "" {
+				etag = "W/" + etag
+			}
+			isEqual(t, w.Header().Get("Etag"), etag, i)
+		} else {
+			zr, err := gzip.NewReader(w.Body)
+			must(err)
+			b, err := io.ReadAll(zr)
+			must(err)
+			isEqual(t, len(b), 34, i)
+		}
+	}
+
+	isEqual(t, cfs.count.Load(), int32(0), "filesystem access")
+}
+
+func TestPreloadCompressedMissingFile(t *testing.T) {
+	_, err := NewAssetHandler("./assets/").PreloadCompressed([]string{"css/nonexisting.css"})
+	isEqual(t, os.IsNotExist(err), true, 0)
+}
+
+func TestPreloadCompressedRange(t *testing.T) {
+	gz, err := os.ReadFile("assets/css/style1.css.gz")
+	must(err)
+
+	cases := []struct {
+		url, encoding, rng string
+		code               int
+		contentRange       string
+		body               string
+	}{
+		{url: "/css/style2.css", encoding: "xx", rng: "bytes=0-3", code: 206, contentRange: "bytes 0-3/34", body: "body"},
+		{url: "/css/style2.css", encoding: "xx", rng: "bytes=-2", code: 206, contentRange: "bytes 32-33/34", body: "}\n"},
+		{url: "/css/style1.css", encoding: "gzip", rng: "bytes=10-19", code: 206, contentRange: "bytes 10-19/60", body: string(gz[10:20])},
+		{url: "/css/style2.css", encoding: "xx", rng: "bytes=100-200", code: 416, contentRange: "bytes */34"},
+	}
+
+	cfs := &countingFS{fs: os.DirFS("assets")}
+	a, err := NewAssetHandlerIoFS(cfs).PreloadCompressed([]string{"css/style1.css", "css/style2.css"})
+	must(err)
+	cfs.count.Store(0)
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.url, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		request.Header.Set("Range", test.rng)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Content-Range"), test.contentRange, i)
+		if test.code == 206 {
+			isEqual(t, w.Body.String(), test.body, i)
+			isEqual(t, w.Header().Get("Content-Length"), strconv.Itoa(len(test.body)), i)
+		}
+	}
+
+	isEqual(t, cfs.count.Load(), int32(0), "filesystem access")
+}
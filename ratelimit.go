@@ -0,0 +1,89 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WithRateLimit alters the handler so that it serves at most perSecond requests per second on
+// average, with bursts of up to burst requests. This is a token bucket shared by all clients of
+// the handler and its copies. Requests that exceed the limit get a 429-too many requests response
+// with a Retry-After header giving the number of seconds until the bucket has refilled enough for
+// another request. Health checks (see WithHealthPath) are never limited. This method panics if
+// perSecond is not positive or burst is less than one.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithRateLimit(perSecond float64, burst int) *Assets {
+	if perSecond <= 0 {
+		panic("Rate limit must be positive")
+	}
+	if burst < 1 {
+		panic("Rate limit burst must be at least one")
+	}
+	a.rateLimit = &tokenBucket{rate: perSecond, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+	return &a
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// take removes a token from the bucket. If there is none, it returns false and the time until
+// the next token will be available.
+func (b *tokenBucket) take() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second)), false
+}
+
+func (a *Assets) serveTooManyRequests(w http.ResponseWriter, req *http.Request, wait time.Duration) {
+	setRetryAfter(w.Header(), wait)
+	a.statusError(w, req, TooManyRequests)
+}
+
+// setRetryAfter sets the whole number of seconds to wait, which is at least one.
+func setRetryAfter(wHeader http.Header, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	wHeader.Set(RetryAfter, strconv.Itoa(seconds))
+}
@@ -0,0 +1,51 @@
+package servefiles
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimit(t *testing.T) {
+	a := NewAssetHandler("./assets/").WithHealthPath("/healthz").WithRateLimit(0.5, 2)
+
+	cases := []struct {
+		path       string
+		code       int
+		retryAfter string
+	}{
+		{path: "/css/style1.css", code: 200},
+		{path: "/css/style1.css", code: 200},
+		{path: "/css/style1.css", code: 429, retryAfter: "2"},
+		{path: "/img/nonexisting.png", code: 429, retryAfter: "2"},
+		{path: "/healthz", code: 200},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Retry-After"), test.retryAfter, i)
+		if test.code == 429 {
+			isEqual(t, w.Body.String(), "429 Too Many Requests\n", i)
+		}
+	}
+}
+
+func TestRateLimitIsSharedByCopies(t *testing.T) {
+	a := NewAssetHandler("./assets/").WithRateLimit(1, 1)
+	b := a.WithMaxAge(0)
+
+	request, _ := http.NewRequest("GET", "/css/style1.css", nil)
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, request)
+	isEqual(t, w.Code, 200, 0)
+
+	w = httptest.NewRecorder()
+	b.ServeHTTP(w, request)
+	isEqual(t, w.Code, 429, 1)
+	isEqual(t, w.Header().Get("Retry-After"), "1", 1)
+}
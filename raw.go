@@ -0,0 +1,84 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"path"
+	"time"
+)
+
+// rawContentTypes gives the content type of each compressed variant when it is served as it is.
+var rawContentTypes = map[string]string{
+	"br":   "application/x-brotli",
+	"gzip": "application/gzip",
+}
+
+// ServeCompressedRaw serves the stored compressed variant of an asset as an opaque download,
+// regardless of the request's Accept-Encoding header. This is intended for mirroring and backup
+// tools. The name is the asset path (e.g. "/css/style.css") and the encoding is "br" or "gzip".
+// The response has no Content-Encoding, so the client will not decompress it, and it has a
+// Content-Disposition header naming the compressed file as an attachment.
+//
+// A 404-not found response is given if the compressed variant does not exist or the encoding is
+// not supported.
+func (a *Assets) ServeCompressedRaw(w http.ResponseWriter, req *http.Request, name, encoding string) {
+	contentType, supported := rawContentTypes[encoding]
+	if !supported {
+		a.httpError(w, NotFound, req.Method)
+		return
+	}
+
+	var ext string
+	for _, variant := range compressedVariants {
+		if variant.encoding == encoding {
+			ext = variant.ext
+		}
+	}
+
+	resource := "/" + removeLeadingSlash(name) + ext
+	fd := a.checkResource(resource, w.Header())
+	if fd.code == Directory {
+		fd.code = NotFound
+	}
+	if fd.code != OK {
+		a.httpError(w, fd.code, req.Method)
+		return
+	}
+
+	h := w.Header()
+	h.Set(ContentType, contentType)
+	h.Set(xContentTypeOptions, "nosniff")
+	h.Set(ContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(resource)}))
+	// strong etag because the representation is exactly the stored file
+	h.Set(ETag, a.etag(resource, fd.fi))
+
+	if mf, isMem := fd.fi.(*memFile); isMem {
+		http.ServeContent(w, req, resource, mf.modTime, bytes.NewReader(mf.content))
+		return
+	}
+
+	a.serveFile(w, req, resource, time.Time{})
+}
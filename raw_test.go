@@ -0,0 +1,48 @@
+package servefiles
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestServeCompressedRaw(t *testing.T) {
+	gz, err := os.ReadFile("assets/css/style1.css.gz")
+	must(err)
+	br, err := os.ReadFile("assets/css/style1.css.br")
+	must(err)
+
+	cases := []struct {
+		name, encoding string
+		code           int
+		conType        string
+		disposition    string
+		body           []byte
+	}{
+		{name: "/css/style1.css", encoding: "gzip", code: 200, conType: "application/gzip", disposition: `attachment; filename=style1.css.gz`, body: gz},
+		{name: "css/style1.css", encoding: "br", code: 200, conType: "application/x-brotli", disposition: `attachment; filename=style1.css.br`, body: br},
+		{name: "/css/style2.css", encoding: "gzip", code: 404, conType: "text/plain; charset=utf-8"},
+		{name: "/css/style1.css", encoding: "zstd", code: 404, conType: "text/plain; charset=utf-8"},
+	}
+
+	a := NewAssetHandler("./assets/")
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", "/download", nil)
+		request.Header.Set("Accept-Encoding", "identity")
+		w := httptest.NewRecorder()
+
+		a.ServeCompressedRaw(w, request, test.name, test.encoding)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Content-Type"), test.conType, i)
+		isEqual(t, w.Header().Get("Content-Encoding"), "", i)
+		isEqual(t, w.Header().Get("Content-Disposition"), test.disposition, i)
+		if test.code == 200 {
+			isEqual(t, bytes.Equal(w.Body.Bytes(), test.body), true, i)
+			isNotEqual(t, w.Header().Get("ETag"), "", i)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// MIT License
+//
+// Copyright (c) 2016 Rick Beton
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package servefiles
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// reportingNameSyntax is the syntax of a structured field key (RFC8941).
+var reportingNameSyntax = regexp.MustCompile(`^[a-z*][a-z0-9_.*-]*$`)
+
+// WithReportingEndpoint alters the handler so that HTML responses have a Reporting-Endpoints
+// header that names the URL to which browsers send reports, e.g. of Content-Security-Policy
+// violations. When there is a Content-Security-Policy (see WithContentSecurityPolicy and
+// WithCSPNonce), "report-to <name>" is appended to it. Other assets get neither header.
+//
+// The name must be a lowercase structured field key, e.g. "csp-endpoint". This method panics if
+// the name is not valid, or if the URL is not valid or contains anything other than printable
+// ASCII characters, which is all that the header allows.
+//
+// The returned handler is a new copy of the original one.
+func (a Assets) WithReportingEndpoint(name, endpoint string) *Assets {
+	if !reportingNameSyntax.MatchString(name) {
+		panic(fmt.Sprintf("Bad reporting endpoint name %q", name))
+	}
+	if _, err := url.Parse(endpoint); err != nil || strings.IndexFunc(endpoint, isNotPrintableASCII) >= 0 {
+		panic(fmt.Sprintf("Bad reporting endpoint URL %q", endpoint))
+	}
+	a.reportingName = name
+	a.reportingURL = endpoint
+	return &a
+}
+
+func isNotPrintableASCII(r rune) bool {
+	return r < 0x20 || r > 0x7e
+}
+
+// reportingEndpoints gets the value of the Reporting-Endpoints header. The URL is a structured
+// field string (RFC8941), in which only backslashes and double quotes are escaped.
+func (a *Assets) reportingEndpoints() string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(a.reportingURL)
+	return a.reportingName + `="` + escaped + `"`
+}
+
+// withReportTo appends the report-to directive to a Content-Security-Policy, if there is a
+// reporting endpoint.
+func (a *Assets) withReportTo(policy string) string {
+	if a.reportingName == "" || policy == "" {
+		return policy
+	}
+	return strings.TrimRight(policy, "; ") + "; report-to " + a.reportingName
+}
@@ -0,0 +1,39 @@
+//go:build unix
+
+package servefiles
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServeHTTPSymlinkLoop(t *testing.T) {
+	dir := t.TempDir()
+	must(os.Symlink(filepath.Join(dir, "b.js"), filepath.Join(dir, "a.js")))
+	must(os.Symlink(filepath.Join(dir, "a.js"), filepath.Join(dir, "b.js")))
+	must(os.WriteFile(filepath.Join(dir, "app.js"), []byte("function app() {}\n"), 0644))
+
+	cases := []struct {
+		path, encoding string
+		code           int
+	}{
+		{path: "/a.js", encoding: "xx", code: 404},
+		{path: "/a.js", encoding: "gzip", code: 404},
+		{path: "/app.js", encoding: "xx", code: 200},
+	}
+
+	for i, test := range cases {
+		request, _ := http.NewRequest("GET", test.path, nil)
+		request.Header.Set("Accept-Encoding", test.encoding)
+		a := NewAssetHandler(dir)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, request)
+
+		isEqual(t, w.Code, test.code, i)
+		isEqual(t, w.Header().Get("Retry-After"), "", i)
+	}
+}
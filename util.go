@@ -53,24 +53,42 @@ func (list List[T]) Contains(wanted T) bool {
 type code int
 
 const (
-	Directory          code = 0
-	OK                 code = 200
-	Forbidden          code = 403
-	NotFound           code = 404
-	MethodNotAllowed   code = 405
-	ServiceUnavailable code = 503
+	Directory                  code = 0
+	OK                         code = 200
+	MovedPermanently           code = 301
+	BadRequest                 code = 400
+	Unauthorized               code = 401
+	Forbidden                  code = 403
+	NotFound                   code = 404
+	MethodNotAllowed           code = 405
+	MisdirectedRequest         code = 421
+	TooManyRequests            code = 429
+	UnavailableForLegalReasons code = 451
+	ServiceUnavailable         code = 503
 )
 
 func (code code) String() string {
 	switch code {
 	case OK:
 		return "200 OK"
+	case MovedPermanently:
+		return "301 Moved Permanently"
+	case BadRequest:
+		return "400 Bad request"
+	case Unauthorized:
+		return "401 Unauthorized"
 	case Forbidden:
 		return "403 Forbidden"
 	case NotFound:
 		return "404 Not found"
 	case MethodNotAllowed:
 		return "405 Method Not Allowed"
+	case MisdirectedRequest:
+		return "421 Misdirected Request"
+	case TooManyRequests:
+		return "429 Too Many Requests"
+	case UnavailableForLegalReasons:
+		return "451 Unavailable For Legal Reasons"
 	case ServiceUnavailable:
 		return "503 Service unavailable"
 	}